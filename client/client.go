@@ -8,18 +8,21 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/nacl/box"
 
+	"ciphertalk/common/codec"
 	"ciphertalk/common/constants"
+	"ciphertalk/common/envelope"
 	"ciphertalk/common/models"
-
-	"github.com/gorilla/websocket"
 )
 
 type keys struct {
@@ -33,15 +36,35 @@ var recepientID = flag.String("to", "bar", "recepient id")
 var messageBody = flag.String("body", "test data", "message body")
 var timeInterval = flag.Duration("interval", time.Second*3, "send message time interval in seconds")
 var listenOnly = flag.Bool("listen-only", false, "client will not send any messages")
+var password = flag.String("password", "", "account password, defaults to $CIPHERTALK_PASSWORD")
+var registerAccount = flag.Bool("register", false, "create the account before logging in")
+var expireAfter = flag.Duration("expire-after", 0, "sent messages disappear after this duration, 0 to keep them")
 var myKeys keys
 
+// websocket connections support only one concurrent writer
+var writeMutex sync.Mutex
+
 func main() {
 	flag.Parse()
+
+	// read after parsing so the password is not printed as the flag's default by -h
+	if *password == "" {
+		*password = os.Getenv("CIPHERTALK_PASSWORD")
+	}
+
+	if err := setupTLS(); err != nil {
+		log.Fatal("invalid TLS configuration: ", err)
+	}
+
 	// generate a new public/private key pair
 	myKeys = generateKeys()
 
+	if *registerAccount {
+		register(*addr, *senderID, *password)
+	}
+
 	// get auth token
-	authToken := login(*addr, *senderID, &myKeys)
+	authToken := login(*addr, *senderID, *password, &myKeys)
 
 	// get recepient's public key (create secure channel)
 	recepientPubKey, err := getRecipientKey(*addr, authToken, *recepientID)
@@ -55,25 +78,39 @@ func main() {
 
 	log.Println("recepient pub key ", recepientPubKey)
 
-	conn := openWebsocket(&authToken)
+	conn := openConnection(&authToken)
 	defer conn.Close()
 
-	if !*listenOnly {
+	if *sealedSender {
+		go keepCertificateFresh(*addr, authToken)
+	}
+
+	if !*listenOnly && !*interactive {
 		go sendMessages(conn, &recepientPubKey)
 	}
 
-	receiveMessages(conn, &recepientPubKey)
+	go readCommands(conn, authToken, &recepientPubKey)
+	go purgeTranscript()
+	go expireTyping()
+
+	receiveMessages(conn, authToken, &recepientPubKey)
 }
 
-func openWebsocket(authToken *string) *websocket.Conn {
-	wsURL := url.URL{Scheme: "ws", Host: *addr, Path: "/websockets"}
+func openWebsocket(authToken *string) connection {
+	wsURL := url.URL{Scheme: wsScheme(), Host: *addr, Path: "/websockets"}
 	headers := http.Header{
 		constants.HTTPAuthorization: {fmt.Sprintf("Bearer %v", *authToken)},
 	}
 
 	log.Printf("connecting to %s", wsURL.String())
 
-	conn, resp, err := websocket.DefaultDialer.Dial(wsURL.String(), headers)
+	// servers which do not know the CBOR subprotocol accept the connection without one and speak JSON
+	d := *dialer
+	if *wireCodec == "cbor" {
+		d.Subprotocols = []string{constants.WebsocketProtocolCBOR}
+	}
+
+	conn, resp, err := d.Dial(wsURL.String(), headers)
 
 	if err != nil {
 		log.Fatal("unable to connect via websocket:", err)
@@ -83,12 +120,37 @@ func openWebsocket(authToken *string) *websocket.Conn {
 		log.Println("server responded with :", resp.StatusCode)
 	}
 
-	return conn
+	return &websocketConnection{Conn: conn, codec: codec.ForProtocol(conn.Subprotocol())}
+}
+
+func register(host string, user string, password string) {
+	var httpURL = url.URL{Scheme: httpScheme(), Host: host, Path: "/register"}
+	var bodyStr, err = json.Marshal(models.RegisterRequest{UserName: user, Password: password})
+
+	if err != nil {
+		log.Fatal("unable to convert JSON object to payload")
+	}
+
+	resp, err := httpClient.Post(httpURL.String(), constants.HTTPApplicationJSON, bytes.NewBuffer(bodyStr))
+	if err != nil {
+		log.Fatal("error happened while sending request:", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		log.Printf("registered account %[1]s", user)
+	case http.StatusConflict:
+		log.Printf("account %[1]s already exists, logging in", user)
+	default:
+		message, _ := io.ReadAll(resp.Body)
+		log.Fatalf("unable to register, server responded with: %[1]d %[2]s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
 }
 
-func login(host string, user string, k *keys) string {
-	var httpURL = url.URL{Scheme: "http", Host: host, Path: "/login"}
-	var loginReq = models.LoginRequest{UserName: user, PublicKey: k.publicKey}
+func login(host string, user string, password string, k *keys) string {
+	var httpURL = url.URL{Scheme: httpScheme(), Host: host, Path: "/login"}
+	var loginReq = models.LoginRequest{UserName: user, Password: password, PublicKey: k.publicKey}
 	var bodyStr, err = json.Marshal(loginReq)
 
 	if err != nil {
@@ -99,13 +161,17 @@ func login(host string, user string, k *keys) string {
 
 	req.Header.Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		log.Fatal("error happened while sending request:", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(resp.Body)
+		log.Fatalf("unable to login, server responded with: %[1]d %[2]s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
 	var loginRes = models.LoginResponse{}
 	err = json.NewDecoder(resp.Body).Decode(&loginRes)
 
@@ -116,7 +182,7 @@ func login(host string, user string, k *keys) string {
 }
 
 func getRecipientKey(host string, authToken string, recepientID string) ([32]byte, error) {
-	var httpURL = url.URL{Scheme: "http", Host: host, Path: "/secure"}
+	var httpURL = url.URL{Scheme: httpScheme(), Host: host, Path: "/secure"}
 	var chReq = models.ChannelRequest{UserName: recepientID}
 	var bodyStr, err = json.Marshal(chReq)
 
@@ -129,8 +195,7 @@ func getRecipientKey(host string, authToken string, recepientID string) ([32]byt
 	req.Header.Set(constants.HTTPAuthorization, fmt.Sprintf("Bearer %v", authToken))
 	req.Header.Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		log.Fatal("error happened while sending request:", err)
 	}
@@ -149,38 +214,79 @@ func getRecipientKey(host string, authToken string, recepientID string) ([32]byt
 	return chRes.PublicKey, nil
 }
 
-func sendMessages(conn *websocket.Conn, recepientKey *[32]byte) {
+func sendMessages(conn connection, recepientKey *[32]byte) {
 	ticker := time.NewTicker(*timeInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case t := <-ticker.C:
-			msgBytes := []byte(*messageBody)
-			encyptedMsg := encrypt(&msgBytes, &myKeys, recepientKey, t.String())
-			err := conn.WriteJSON(encyptedMsg)
+			id, err := sendPayload(conn, models.Payload{Text: *messageBody}, recepientKey, t)
 
 			if err != nil {
 				log.Println("Unable to send message:", err)
 			}
-			log.Printf("sent to recepient:%[1]v message: %[2]v\n", *recepientID, *messageBody)
+			log.Printf("sent to recepient:%[1]v message [%[2]s]: %[3]v\n", *recepientID, shortID(id), *messageBody)
 		}
 	}
 }
 
-func receiveMessages(conn *websocket.Conn, recepientKey *[32]byte) {
+func send(conn connection, msg models.Message, recepientKey *[32]byte) error {
+	if *sealedSender {
+		sealed, err := sealMessage(msg, recepientKey)
+		if err != nil {
+			return err
+		}
+		return sendSealed(*addr, sealed)
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	return conn.WriteFrame(msg)
+}
+
+func receiveMessages(conn connection, authToken string, recepientKey *[32]byte) {
 	defer conn.Close()
 
 	for {
-		var msg models.Message
-		err := conn.ReadJSON(&msg)
+		_, frame, err := conn.ReadMessage()
 
 		if err != nil {
 			log.Println("read:", err)
 			return
 		}
 
-		decryptAndPrint(msg, &myKeys, recepientKey)
+		var errFrame models.ErrorFrame
+		if conn.Unmarshal(frame, &errFrame) == nil && errFrame.Error != "" {
+			log.Printf("server rejected message (%[1]d): %[2]s", errFrame.Code, errFrame.Error)
+			continue
+		}
+
+		var msg models.Message
+		if err = conn.Unmarshal(frame, &msg); err != nil {
+			log.Println("unable to parse message:", err)
+			continue
+		}
+
+		senderKey := recepientKey
+		if msg.Sealed {
+			if msg, err = openSealed(msg, &myKeys); err != nil {
+				log.Println(err)
+				continue
+			}
+
+			if msg.SenderID != *recepientID {
+				key, err := getRecipientKey(*addr, authToken, msg.SenderID)
+				if err != nil {
+					log.Printf("unable to find key of sender %[1]s: %[2]v", msg.SenderID, err)
+					continue
+				}
+				senderKey = &key
+			}
+		}
+
+		decryptAndPrint(msg, &myKeys, senderKey)
 	}
 }
 
@@ -194,31 +300,64 @@ func generateKeys() keys {
 	return keys{publicKey: *pubKey, privateKey: *priKey}
 }
 
-func encrypt(msgBytes *[]byte, myKeys *keys, recepientKey *[32]byte, timeStamp string) models.Message {
-	var out []byte
-	var nonce [24]byte
-	randomizeNonce(&nonce)
-	encryptedBytes := box.Seal(out, *msgBytes, &nonce, recepientKey, &myKeys.privateKey)
+// encryptPayload seals payload for the recepient, assigning it a message id and setting its expiry
+// when messages are configured to disappear
+func encryptPayload(payload models.Payload, recepientKey *[32]byte, t time.Time) (models.Message, error) {
+	if *expireAfter > 0 {
+		payload.ExpiresAt = t.Add(*expireAfter).Unix()
+	}
+
+	msg, err := envelope.Seal(payload, *senderID, *recepientID, recepientKey, &myKeys.privateKey, t)
+	if err != nil {
+		return msg, err
+	}
 
-	return models.Message{
-		SenderID:    *senderID,
-		RecipientID: *recepientID,
-		Body:        encryptedBytes,
-		TimeStamp:   timeStamp,
-		MsgNonce:    nonce,
+	if *expireAfter > 0 {
+		msg.TTL = int64(expireAfter.Seconds())
 	}
+
+	return msg, nil
+}
+
+// sendPayload sends payload to the recepient and keeps sent text in the transcript so it can be edited later
+func sendPayload(conn connection, payload models.Payload, recepientKey *[32]byte, t time.Time) (string, error) {
+	msg, err := encryptPayload(payload, recepientKey, t)
+	if err != nil {
+		return "", err
+	}
+
+	if err = send(conn, msg, recepientKey); err != nil {
+		return msg.ID, err
+	}
+
+	if payload.Edit == "" && payload.Delete == "" && payload.Reaction == nil {
+		entry := transcriptEntry{id: msg.ID, sender: *senderID, text: payload.Text}
+		if *expireAfter > 0 {
+			entry.expires = t.Add(*expireAfter)
+		}
+		addToTranscript(entry)
+	}
+
+	return msg.ID, nil
+}
+
+// shortID is displayed to the user and accepted by commands in place of the full message id
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
 }
 
 func decryptAndPrint(msg models.Message, myKeys *keys, recepientKey *[32]byte) {
-	var out []byte
-	decryptedBytes, success := box.Open(out, msg.Body, &msg.MsgNonce, recepientKey, &myKeys.privateKey)
+	payload, err := envelope.Open(msg, recepientKey, &myKeys.privateKey)
 
-	if !success {
-		log.Printf("Something went wrong... unable to decrypt message: %[1]s", decryptedBytes)
-	} else {
-		decryptedMsg := string(decryptedBytes[:len(decryptedBytes)])
-		log.Printf("recieved message from %[1]s. Message: %[2]s", msg.SenderID, decryptedMsg)
+	if err != nil {
+		log.Printf("Something went wrong... %[1]v", err)
+		return
 	}
+
+	showPayload(msg, payload)
 }
 
 func randomizeNonce(nonce *[24]byte) {
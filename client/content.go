@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"ciphertalk/common/models"
+)
+
+// showPayload applies decrypted payload to the transcript and displays it according to its content type
+func showPayload(msg models.Message, payload models.Payload) {
+	if msg.Ephemeral {
+		showSignal(msg.SenderID, payload.Signal)
+		return
+	}
+
+	expires := time.Time{}
+	if payload.ExpiresAt != 0 {
+		expires = time.Unix(payload.ExpiresAt, 0)
+		if !time.Now().Before(expires) {
+			log.Printf("discarded expired message from %[1]s", msg.SenderID)
+			return
+		}
+	}
+
+	if payload.ID == "" {
+		payload.ID = msg.ID
+	}
+
+	switch payload.Type {
+	case models.ContentDelete:
+		if deleteFromTranscript(msg.SenderID, payload.Delete) {
+			log.Printf("%[1]s deleted message [%[2]s]", msg.SenderID, shortID(payload.Delete))
+		}
+		return
+	case models.ContentEdit:
+		if editInTranscript(msg.SenderID, payload.Edit, payload.Text) {
+			log.Printf("%[1]s edited message [%[2]s]: %[3]s", msg.SenderID, shortID(payload.Edit), payload.Text)
+		}
+		return
+	case models.ContentReaction:
+		if payload.Reaction != nil && reactInTranscript(msg.SenderID, *payload.Reaction) {
+			log.Printf("%[1]s %[2]s to [%[3]s] %[4]s", msg.SenderID, payload.Text, shortID(payload.Reaction.MessageID), quote(payload.Reaction.MessageID))
+		}
+		return
+	case models.ContentFile:
+		if payload.File == nil {
+			log.Printf("recieved invalid file offer from %[1]s [%[2]s] without a file", msg.SenderID, shortID(payload.ID))
+			return
+		}
+	}
+
+	entry := transcriptEntry{id: payload.ID, sender: msg.SenderID, text: payload.Text, replyTo: payload.ReplyTo, expires: expires}
+
+	switch payload.Type {
+	case models.ContentFile:
+		entry.fileID = offerFile(msg.SenderID, *payload.File)
+	case models.ContentReply:
+		log.Printf("recieved reply from %[1]s [%[2]s] to [%[3]s] %[4]s. Message: %[5]s%[6]s", msg.SenderID, shortID(payload.ID), shortID(payload.ReplyTo), quote(payload.ReplyTo), payload.Text, describeExpiry(expires))
+	case models.ContentText:
+		log.Printf("recieved message from %[1]s [%[2]s]. Message: %[3]s%[4]s", msg.SenderID, shortID(payload.ID), payload.Text, describeExpiry(expires))
+	default:
+		log.Printf("recieved %[1]s from %[2]s [%[3]s], update the client to display it. Message: %[4]s", payload.Type, msg.SenderID, shortID(payload.ID), payload.Text)
+	}
+
+	addToTranscript(entry)
+}
+
+// quote returns a short excerpt of a message from the transcript
+func quote(id string) string {
+	text, ok := transcriptText(id)
+	if !ok {
+		return "(unknown message)"
+	}
+
+	if runes := []rune(text); len(runes) > 30 {
+		text = string(runes[:30]) + "..."
+	}
+	return "\"" + text + "\""
+}
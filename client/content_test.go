@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"ciphertalk/common/models"
+)
+
+func TestShowPayload_FileWithoutManifest(t *testing.T) {
+	// arrange
+	msg := models.Message{ID: "file-offer", SenderID: "mallory"}
+	payload := models.DecodePayload([]byte(`{"v":1,"type":"file"}`))
+	// act
+	showPayload(msg, payload)
+	// assert
+	if _, ok := transcriptText("file-offer"); ok {
+		t.Error("Invalid file offer should not be added to the transcript")
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+)
+
+// size of plaintext file chunk, every chunk is encrypted and uploaded separately
+const chunkSize = 64 * 1024
+
+var downloadDir = flag.String("downloads", ".", "directory where received files are saved")
+
+// files offered by other clients, keyed by short file id
+var offeredFiles = make(map[string]models.FileManifest)
+var offeredFilesMutex sync.Mutex
+
+func sendFile(conn connection, authToken string, recepientKey *[32]byte, path string) error {
+	if path == "" {
+		return errors.New("usage: /send-file <path>")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	manifest := models.FileManifest{Name: filepath.Base(path), Size: info.Size()}
+	if _, err = rand.Read(manifest.Key[:]); err != nil {
+		return err
+	}
+
+	total := (info.Size() + chunkSize - 1) / chunkSize
+	hasher := sha256.New()
+	chunk := make([]byte, chunkSize)
+
+	for {
+		n, err := io.ReadFull(file, chunk)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		hasher.Write(chunk[:n])
+
+		var nonce [24]byte
+		randomizeNonce(&nonce)
+		sealed := secretbox.Seal(nonce[:], chunk[:n], &nonce, (*[32]byte)(&manifest.Key))
+		hash := hashHex(sealed)
+
+		if err = uploadBlob(*addr, authToken, hash, sealed); err != nil {
+			return err
+		}
+
+		manifest.Chunks = append(manifest.Chunks, hash)
+		reportProgress("uploading", manifest.Name, len(manifest.Chunks), total)
+	}
+
+	manifest.Hash = hex.EncodeToString(hasher.Sum(nil))
+
+	if _, err = sendPayload(conn, models.Payload{File: &manifest}, recepientKey, time.Now()); err != nil {
+		return err
+	}
+
+	log.Printf("sent file %[1]s (%[2]d bytes) to recepient: %[3]s", manifest.Name, manifest.Size, *recepientID)
+	return nil
+}
+
+func getFile(authToken string, id string) error {
+	offeredFilesMutex.Lock()
+	manifest, ok := offeredFiles[id]
+	offeredFilesMutex.Unlock()
+
+	if !ok {
+		return errors.New("usage: /get-file <id>, no file with id " + id)
+	}
+
+	name := filepath.Base(manifest.Name)
+	if name != manifest.Name || name == "." || name == ".." || name == string(filepath.Separator) {
+		return fmt.Errorf("invalid file name %[1]q", manifest.Name)
+	}
+
+	out, target, err := createDownload(name)
+	if err != nil {
+		return err
+	}
+
+	err = downloadChunks(authToken, &manifest, out)
+	out.Close()
+
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	log.Printf("saved file %[1]s", target)
+	return nil
+}
+
+// createDownload creates a new file for name in the downloads directory, existing files are never overwritten,
+// a numbered suffix is added to the name instead
+func createDownload(name string) (*os.File, string, error) {
+	ext := filepath.Ext(name)
+	base := name[:len(name)-len(ext)]
+
+	for i := 0; ; i++ {
+		target := filepath.Join(*downloadDir, name)
+		if i > 0 {
+			target = filepath.Join(*downloadDir, fmt.Sprintf("%[1]s (%[2]d)%[3]s", base, i, ext))
+		}
+
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if !errors.Is(err, os.ErrExist) {
+			return out, target, err
+		}
+	}
+}
+
+func downloadChunks(authToken string, manifest *models.FileManifest, out io.Writer) error {
+	hasher := sha256.New()
+	var size int64
+
+	for i, hash := range manifest.Chunks {
+		sealed, err := downloadBlob(*addr, authToken, hash)
+		if err != nil {
+			return err
+		}
+
+		if hashHex(sealed) != hash || len(sealed) < 24 {
+			return errors.New("chunk " + hash + " is corrupted")
+		}
+
+		var nonce [24]byte
+		copy(nonce[:], sealed[:24])
+		plain, ok := secretbox.Open(nil, sealed[24:], &nonce, (*[32]byte)(&manifest.Key))
+		if !ok {
+			return errors.New("unable to decrypt chunk " + hash)
+		}
+
+		hasher.Write(plain)
+		size += int64(len(plain))
+
+		if _, err = out.Write(plain); err != nil {
+			return err
+		}
+
+		reportProgress("downloading", manifest.Name, i+1, int64(len(manifest.Chunks)))
+	}
+
+	if size != manifest.Size || hex.EncodeToString(hasher.Sum(nil)) != manifest.Hash {
+		return errors.New("file " + manifest.Name + " does not match its hash")
+	}
+
+	return nil
+}
+
+// offerFile remembers a file received from another client until the user downloads it and returns its id
+func offerFile(senderID string, manifest models.FileManifest) string {
+	id := manifest.Hash
+	if len(id) > 8 {
+		id = id[:8]
+	}
+
+	offeredFilesMutex.Lock()
+	offeredFiles[id] = manifest
+	offeredFilesMutex.Unlock()
+
+	log.Printf("recieved file from %[1]s: %[2]s (%[3]d bytes). Type \"/get-file %[4]s\" to download it", senderID, manifest.Name, manifest.Size, id)
+	return id
+}
+
+// forgetFile removes a file offer, once it is gone the file can no longer be downloaded
+func forgetFile(id string) {
+	offeredFilesMutex.Lock()
+	delete(offeredFiles, id)
+	offeredFilesMutex.Unlock()
+}
+
+func reportProgress(action string, name string, done int, total int64) {
+	percent := int64(100)
+	if total > 0 {
+		percent = int64(done) * 100 / total
+	}
+	log.Printf("%[1]s %[2]s: %[3]d/%[4]d chunks (%[5]d%%)", action, name, done, total, percent)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func uploadBlob(host string, authToken string, hash string, data []byte) error {
+	var httpURL = url.URL{Scheme: httpScheme(), Host: host, Path: "/blobs/" + hash}
+	req, err := http.NewRequest(constants.HTTPPut, httpURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(constants.HTTPAuthorization, fmt.Sprintf("Bearer %v", authToken))
+	req.Header.Set(constants.HTTPContentType, constants.HTTPOctetStream)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unable to upload chunk %[1]s, server responded with: %[2]d", hash, resp.StatusCode)
+	}
+
+	return nil
+}
+
+func downloadBlob(host string, authToken string, hash string) ([]byte, error) {
+	var httpURL = url.URL{Scheme: httpScheme(), Host: host, Path: "/blobs/" + hash}
+	req, err := http.NewRequest(constants.HTTPGet, httpURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(constants.HTTPAuthorization, fmt.Sprintf("Bearer %v", authToken))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to download chunk %[1]s, server responded with: %[2]d", hash, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ciphertalk/common/models"
+)
+
+var interactive = flag.Bool("interactive", false, "send lines typed into the console as messages instead of sending --body periodically")
+
+// typing indicator is hidden when no update arrives for this long
+const typingTimeout = 5 * time.Second
+
+// readCommands reads lines typed by the user. In interactive mode lines which are not commands are sent as messages.
+//
+//	/send-file <path>  encrypts and uploads a file, then sends it to the recepient
+//	/get-file <id>     downloads, verifies and decrypts a file received from another client
+//	/typing            tells the recepient you are composing a message
+//	/edit <id> <text>  replaces text of a message you sent
+//	/delete <id>       deletes a message you sent, also from the server if it has not been delivered yet
+//	/reply <id> <text> replies to a message
+//	/react <id> <emoji> reacts to a message, /unreact <id> <emoji> removes the reaction
+func readCommands(conn connection, authToken string, recepientKey *[32]byte) {
+	if *interactive {
+		sendSignal(conn, models.SignalFocused, recepientKey)
+		defer sendSignal(conn, models.SignalUnfocused, recepientKey)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var err error
+		if !strings.HasPrefix(line, "/") && *interactive {
+			var id string
+			id, err = sendPayload(conn, models.Payload{Text: line}, recepientKey, time.Now())
+			if err == nil {
+				log.Printf("sent message [%[1]s]", shortID(id))
+			}
+			sendSignal(conn, models.SignalStoppedTyping, recepientKey)
+		} else {
+			err = runCommand(conn, authToken, recepientKey, line)
+		}
+
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func runCommand(conn connection, authToken string, recepientKey *[32]byte, line string) error {
+	pieces := strings.SplitN(line, " ", 2)
+
+	var arg string
+	if len(pieces) == 2 {
+		arg = strings.TrimSpace(pieces[1])
+	}
+
+	switch pieces[0] {
+	case "/send-file":
+		return sendFile(conn, authToken, recepientKey, arg)
+	case "/get-file":
+		return getFile(authToken, arg)
+	case "/typing":
+		return sendSignal(conn, models.SignalTyping, recepientKey)
+	case "/edit":
+		return editMessage(conn, recepientKey, arg)
+	case "/delete":
+		return deleteMessage(conn, recepientKey, arg)
+	case "/reply":
+		return replyToMessage(conn, recepientKey, arg)
+	case "/react", "/unreact":
+		return reactToMessage(conn, recepientKey, arg, pieces[0] == "/unreact")
+	}
+
+	return errors.New("unknown command " + pieces[0])
+}
+
+func editMessage(conn connection, recepientKey *[32]byte, arg string) error {
+	pieces := strings.SplitN(arg, " ", 2)
+	id, ok := findOwnMessage(pieces[0])
+	if !ok || len(pieces) != 2 {
+		return errors.New("usage: /edit <id> <text>, id of a message you sent")
+	}
+
+	text := strings.TrimSpace(pieces[1])
+	if _, err := sendPayload(conn, models.Payload{Edit: id, Text: text}, recepientKey, time.Now()); err != nil {
+		return err
+	}
+
+	editInTranscript(*senderID, id, text)
+	log.Printf("edited message [%[1]s]", shortID(id))
+	return nil
+}
+
+func deleteMessage(conn connection, recepientKey *[32]byte, arg string) error {
+	id, ok := findOwnMessage(arg)
+	if !ok {
+		return errors.New("usage: /delete <id>, id of a message you sent")
+	}
+
+	if _, err := sendPayload(conn, models.Payload{Delete: id}, recepientKey, time.Now()); err != nil {
+		return err
+	}
+
+	deleteFromTranscript(*senderID, id)
+	log.Printf("deleted message [%[1]s]", shortID(id))
+	return nil
+}
+
+func replyToMessage(conn connection, recepientKey *[32]byte, arg string) error {
+	pieces := strings.SplitN(arg, " ", 2)
+	id, ok := findMessage(pieces[0])
+	if !ok || len(pieces) != 2 {
+		return errors.New("usage: /reply <id> <text>")
+	}
+
+	replyID, err := sendPayload(conn, models.Payload{ReplyTo: id, Text: strings.TrimSpace(pieces[1])}, recepientKey, time.Now())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("sent reply [%[1]s] to [%[2]s]", shortID(replyID), shortID(id))
+	return nil
+}
+
+func reactToMessage(conn connection, recepientKey *[32]byte, arg string, remove bool) error {
+	pieces := strings.Fields(arg)
+	if len(pieces) != 2 {
+		return errors.New("usage: /react <id> <emoji>")
+	}
+
+	id, ok := findMessage(pieces[0])
+	if !ok {
+		return errors.New("no message with id " + pieces[0])
+	}
+
+	reaction := models.Reaction{MessageID: id, Emoji: pieces[1], Remove: remove}
+	if _, err := sendPayload(conn, models.Payload{Reaction: &reaction}, recepientKey, time.Now()); err != nil {
+		return err
+	}
+
+	reactInTranscript(*senderID, reaction)
+	return nil
+}
+
+// sendSignal sends an ephemeral message, the server relays it only if the recepient is online
+func sendSignal(conn connection, signal string, recepientKey *[32]byte) error {
+	msg, err := encryptPayload(models.Payload{Signal: signal}, recepientKey, time.Now())
+	if err != nil {
+		return err
+	}
+	msg.Ephemeral = true
+	msg.TTL = 0
+
+	return send(conn, msg, recepientKey)
+}
+
+// peers currently typing, mapped to the time their indicator is hidden
+var typing = make(map[string]time.Time)
+var typingMutex sync.Mutex
+
+// showSignal displays signal received from another client
+func showSignal(senderID string, signal string) {
+	typingMutex.Lock()
+	defer typingMutex.Unlock()
+
+	switch signal {
+	case models.SignalTyping:
+		if _, ok := typing[senderID]; !ok {
+			log.Printf("%[1]s is typing...", senderID)
+		}
+		typing[senderID] = time.Now().Add(typingTimeout)
+	case models.SignalStoppedTyping:
+		delete(typing, senderID)
+	case models.SignalFocused:
+		log.Printf("%[1]s opened the conversation", senderID)
+	case models.SignalUnfocused:
+		delete(typing, senderID)
+		log.Printf("%[1]s left the conversation", senderID)
+	}
+}
+
+// expireTyping hides typing indicators of peers which stopped sending updates
+func expireTyping() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for t := range ticker.C {
+		typingMutex.Lock()
+		for senderID, hide := range typing {
+			if t.After(hide) {
+				delete(typing, senderID)
+				log.Printf("%[1]s stopped typing", senderID)
+			}
+		}
+		typingMutex.Unlock()
+	}
+}
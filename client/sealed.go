@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+)
+
+var sealedSender = flag.Bool("sealed-sender", false, "hide sender identity and timestamp from the server")
+
+// certificate which authorizes delivery of sealed sender messages
+var certificate models.DeliveryCertificateResponse
+var certificateMutex sync.Mutex
+
+// keepCertificateFresh requests a new delivery certificate shortly before the current one expires
+func keepCertificateFresh(host string, authToken string) {
+	for {
+		cert, err := getDeliveryCertificate(host, authToken)
+		if err != nil {
+			log.Println("unable to get delivery certificate:", err)
+			time.Sleep(*timeInterval)
+			continue
+		}
+
+		certificateMutex.Lock()
+		certificate = cert
+		certificateMutex.Unlock()
+
+		time.Sleep(time.Until(time.Unix(cert.Expires, 0)) / 2)
+	}
+}
+
+func getDeliveryCertificate(host string, authToken string) (models.DeliveryCertificateResponse, error) {
+	var cert models.DeliveryCertificateResponse
+	var httpURL = url.URL{Scheme: httpScheme(), Host: host, Path: "/delivery-certificate"}
+	req, err := http.NewRequest(constants.HTTPPost, httpURL.String(), nil)
+	if err != nil {
+		return cert, err
+	}
+
+	req.Header.Set(constants.HTTPAuthorization, fmt.Sprintf("Bearer %v", authToken))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return cert, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return cert, fmt.Errorf("server responded with: %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&cert)
+	return cert, err
+}
+
+// sealMessage moves sender identity, timestamp and the sender's box into an anonymous box for the recepient
+func sealMessage(msg models.Message, recepientKey *[32]byte) (models.Message, error) {
+	content, err := json.Marshal(models.SealedContent{
+		SenderID:  msg.SenderID,
+		TimeStamp: msg.TimeStamp,
+		Body:      msg.Body,
+		MsgNonce:  msg.MsgNonce,
+	})
+	if err != nil {
+		return msg, err
+	}
+
+	body, err := box.SealAnonymous(nil, content, recepientKey, rand.Reader)
+	if err != nil {
+		return msg, err
+	}
+
+	certificateMutex.Lock()
+	cert := certificate.Certificate
+	certificateMutex.Unlock()
+
+	if cert == "" {
+		return msg, errors.New("no delivery certificate yet")
+	}
+
+	return models.Message{
+		ID:          msg.ID,
+		RecipientID: msg.RecipientID,
+		Body:        body,
+		Sealed:      true,
+		Certificate: cert,
+		TTL:         msg.TTL,
+		Ephemeral:   msg.Ephemeral,
+		// the server can not tell who sent a sealed message, so it never retracts queued ones
+	}, nil
+}
+
+// sendSealed posts a sealed message without authentication, so the server can not tell who sent it
+func sendSealed(host string, msg models.Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	var httpURL = url.URL{Scheme: httpScheme(), Host: host, Path: "/sealed"}
+	resp, err := httpClient.Post(httpURL.String(), constants.HTTPApplicationJSON, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("server responded with: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// openSealed restores sender identity and timestamp of a sealed message, the body stays encrypted by the sender
+func openSealed(msg models.Message, myKeys *keys) (models.Message, error) {
+	content, ok := box.OpenAnonymous(nil, msg.Body, &myKeys.publicKey, &myKeys.privateKey)
+	if !ok {
+		return msg, errors.New("unable to open sealed message")
+	}
+
+	var sealed models.SealedContent
+	if err := json.Unmarshal(content, &sealed); err != nil {
+		return msg, err
+	}
+
+	return models.Message{
+		ID:          msg.ID,
+		SenderID:    sealed.SenderID,
+		RecipientID: msg.RecipientID,
+		Body:        sealed.Body,
+		TimeStamp:   sealed.TimeStamp,
+		MsgNonce:    sealed.MsgNonce,
+		Ephemeral:   msg.Ephemeral,
+	}, nil
+}
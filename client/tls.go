@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/websocket"
+)
+
+var useTLS = flag.Bool("tls", false, "connect with https and wss")
+var caFile = flag.String("ca-file", "", "PEM bundle of CAs trusted in addition to the system roots")
+var pinSHA256 = flag.String("pin-sha256", "", "base64 sha256 of the server's public key, when set without --ca-file it replaces CA verification")
+var clientCert = flag.String("cert", "", "PEM client certificate for servers which require mTLS")
+var clientKey = flag.String("key", "", "PEM private key for --cert")
+
+// httpClient and dialer are used for every request to the server, setupTLS configures them
+var httpClient = http.DefaultClient
+var dialer = websocket.DefaultDialer
+
+func httpScheme() string {
+	if *useTLS {
+		return "https"
+	}
+	return "http"
+}
+
+func wsScheme() string {
+	if *useTLS {
+		return "wss"
+	}
+	return "ws"
+}
+
+// setupTLS configures httpClient and dialer from the TLS flags
+func setupTLS() error {
+	if !*useTLS {
+		return nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if *caFile != "" {
+		pem, err := os.ReadFile(*caFile)
+		if err != nil {
+			return err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + *caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if *clientCert != "" || *clientKey != "" {
+		cert, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if *pinSHA256 != "" {
+		pin, err := base64.StdEncoding.DecodeString(*pinSHA256)
+		if err != nil || len(pin) != sha256.Size {
+			return errors.New("--pin-sha256 must be base64 encoded sha256")
+		}
+
+		// a pinned key is trusted on its own, e.g. for the server's self-signed development certificate
+		config.InsecureSkipVerify = *caFile == ""
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPin(state, pin, config.RootCAs)
+		}
+	}
+
+	httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	dialer = &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		TLSClientConfig:  config,
+	}
+
+	return nil
+}
+
+// verifyPin checks that the server's leaf certificate has the pinned public key.
+// When CA verification is skipped, the certificate still has to be valid for the server name.
+func verifyPin(state tls.ConnectionState, pin []byte, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server did not present a certificate")
+	}
+
+	leaf := state.PeerCertificates[0]
+	sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	if string(sum[:]) != string(pin) {
+		return errors.New("server certificate does not match the pinned public key")
+	}
+
+	if roots == nil {
+		return leaf.VerifyHostname(state.ServerName)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ciphertalk/common/models"
+)
+
+// how often expired messages are removed from the transcript
+const transcriptPurgeInterval = time.Second
+
+// number of most recent messages kept in the transcript
+const transcriptSize = 1000
+
+type transcriptEntry struct {
+	id      string
+	sender  string
+	text    string
+	fileID  string
+	replyTo string
+	// reactions maps emoji to users who reacted with it
+	reactions map[string][]string
+	received  time.Time
+	// zero expires means the message never disappears
+	expires time.Time
+}
+
+// transcript is the local store of received plaintext messages
+var transcript []transcriptEntry
+var transcriptMutex sync.Mutex
+
+func addToTranscript(entry transcriptEntry) {
+	entry.received = time.Now()
+
+	transcriptMutex.Lock()
+	transcript = append(transcript, entry)
+	if len(transcript) > transcriptSize {
+		transcript = transcript[len(transcript)-transcriptSize:]
+	}
+	transcriptMutex.Unlock()
+}
+
+// purgeTranscript deletes disappearing messages once they expire, including offers of files they carried
+func purgeTranscript() {
+	ticker := time.NewTicker(transcriptPurgeInterval)
+	defer ticker.Stop()
+
+	for t := range ticker.C {
+		transcriptMutex.Lock()
+		kept := transcript[:0]
+		for _, entry := range transcript {
+			if entry.expires.IsZero() || t.Before(entry.expires) {
+				kept = append(kept, entry)
+				continue
+			}
+
+			if entry.fileID != "" {
+				forgetFile(entry.fileID)
+			}
+			log.Printf("message from %[1]s received at %[2]s disappeared", entry.sender, entry.received.Format(time.Kitchen))
+		}
+		transcript = kept
+		transcriptMutex.Unlock()
+	}
+}
+
+func describeExpiry(expires time.Time) string {
+	if expires.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(" (disappears in %v)", time.Until(expires).Round(time.Second))
+}
+
+// findMessage returns full id of any message in the transcript given its id or a prefix of it
+func findMessage(prefix string) (string, bool) {
+	transcriptMutex.Lock()
+	defer transcriptMutex.Unlock()
+
+	for i := len(transcript) - 1; i >= 0; i-- {
+		if prefix != "" && strings.HasPrefix(transcript[i].id, prefix) {
+			return transcript[i].id, true
+		}
+	}
+
+	return "", false
+}
+
+func transcriptText(id string) (string, bool) {
+	transcriptMutex.Lock()
+	defer transcriptMutex.Unlock()
+
+	for _, entry := range transcript {
+		if entry.id == id {
+			return entry.text, true
+		}
+	}
+
+	return "", false
+}
+
+// reactInTranscript adds or removes reaction of sender on a message
+func reactInTranscript(sender string, reaction models.Reaction) bool {
+	transcriptMutex.Lock()
+	defer transcriptMutex.Unlock()
+
+	for i := range transcript {
+		if transcript[i].id != reaction.MessageID {
+			continue
+		}
+
+		entry := &transcript[i]
+		if entry.reactions == nil {
+			entry.reactions = make(map[string][]string)
+		}
+
+		var users []string
+		for _, user := range entry.reactions[reaction.Emoji] {
+			if user != sender {
+				users = append(users, user)
+			}
+		}
+
+		if !reaction.Remove {
+			users = append(users, sender)
+		}
+		entry.reactions[reaction.Emoji] = users
+		return true
+	}
+
+	return false
+}
+
+// findOwnMessage returns full id of a message sent by this client given its id or a prefix of it
+func findOwnMessage(prefix string) (string, bool) {
+	transcriptMutex.Lock()
+	defer transcriptMutex.Unlock()
+
+	for i := len(transcript) - 1; i >= 0; i-- {
+		entry := transcript[i]
+		if prefix != "" && entry.sender == *senderID && strings.HasPrefix(entry.id, prefix) {
+			return entry.id, true
+		}
+	}
+
+	return "", false
+}
+
+// editInTranscript replaces text of a message, only the original sender may edit it
+func editInTranscript(sender string, id string, text string) bool {
+	transcriptMutex.Lock()
+	defer transcriptMutex.Unlock()
+
+	for i := range transcript {
+		if transcript[i].id == id && transcript[i].sender == sender {
+			transcript[i].text = text
+			return true
+		}
+	}
+
+	return false
+}
+
+// deleteFromTranscript removes a message, only the original sender may delete it
+func deleteFromTranscript(sender string, id string) bool {
+	transcriptMutex.Lock()
+	defer transcriptMutex.Unlock()
+
+	for i, entry := range transcript {
+		if entry.id == id && entry.sender == sender {
+			if entry.fileID != "" {
+				forgetFile(entry.fileID)
+			}
+			transcript = append(transcript[:i], transcript[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ciphertalk/common/codec"
+	"ciphertalk/common/constants"
+
+	"github.com/gorilla/websocket"
+)
+
+var transport = flag.String("transport", "websocket", "how to talk to the server: websocket, or http for networks which block websockets")
+var wireCodec = flag.String("codec", "json", "websocket frame encoding: json, or cbor for smaller binary frames")
+
+// connection sends messages to the server and reads frames routed to this client
+type connection interface {
+	WriteFrame(v interface{}) error
+	ReadMessage() (int, []byte, error)
+	// Unmarshal decodes a frame returned by ReadMessage
+	Unmarshal(data []byte, v interface{}) error
+	Close() error
+}
+
+func openConnection(authToken *string) connection {
+	if *wireCodec != "json" && *wireCodec != "cbor" {
+		log.Fatalf("unknown codec %[1]s", *wireCodec)
+	}
+
+	switch *transport {
+	case "websocket":
+		return openWebsocket(authToken)
+	case "http":
+		return openStream(authToken)
+	}
+
+	log.Fatalf("unknown transport %[1]s", *transport)
+	return nil
+}
+
+// websocketConnection encodes frames with the codec negotiated with the server
+type websocketConnection struct {
+	*websocket.Conn
+	codec codec.Codec
+}
+
+// WriteFrame sends v as a text or binary message depending on the codec
+func (c *websocketConnection) WriteFrame(v interface{}) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if c.codec.Binary() {
+		return c.WriteMessage(websocket.BinaryMessage, data)
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// Unmarshal decodes a frame with the negotiated codec
+func (c *websocketConnection) Unmarshal(data []byte, v interface{}) error {
+	return c.codec.Unmarshal(data, v)
+}
+
+// httpConnection posts messages to /messages and reads frames from the /messages/stream event stream
+type httpConnection struct {
+	authToken string
+	stream    io.ReadCloser
+	reader    *bufio.Reader
+}
+
+func openStream(authToken *string) connection {
+	var httpURL = url.URL{Scheme: httpScheme(), Host: *addr, Path: "/messages/stream"}
+	req, err := http.NewRequest(constants.HTTPGet, httpURL.String(), nil)
+	if err != nil {
+		log.Fatal("unable to create request:", err)
+	}
+
+	req.Header.Set(constants.HTTPAuthorization, fmt.Sprintf("Bearer %v", *authToken))
+	req.Header.Set("Accept", "text/event-stream")
+
+	log.Printf("connecting to %s", httpURL.String())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Fatal("unable to open event stream:", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		log.Fatal("unable to open event stream, server responded with: ", resp.StatusCode)
+	}
+
+	return &httpConnection{authToken: *authToken, stream: resp.Body, reader: bufio.NewReader(resp.Body)}
+}
+
+// WriteFrame posts a message to the server as JSON
+func (c *httpConnection) WriteFrame(v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var httpURL = url.URL{Scheme: httpScheme(), Host: *addr, Path: "/messages"}
+	req, err := http.NewRequest(constants.HTTPPost, httpURL.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(constants.HTTPAuthorization, fmt.Sprintf("Bearer %v", c.authToken))
+	req.Header.Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server responded with: %[1]d %[2]s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// ReadMessage returns data of the next server-sent event
+func (c *httpConnection) ReadMessage() (int, []byte, error) {
+	var data []byte
+
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return 0, nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "" && data != nil:
+			return websocket.TextMessage, data, nil
+		case strings.HasPrefix(line, "data:"):
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+}
+
+// Unmarshal decodes a frame, events always carry JSON
+func (c *httpConnection) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Close ends the event stream
+func (c *httpConnection) Close() error {
+	if c.stream == nil {
+		return errors.New("stream is not open")
+	}
+	return c.stream.Close()
+}
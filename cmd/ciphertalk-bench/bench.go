@@ -0,0 +1,229 @@
+package main
+
+import (
+	"ciphertalk/common/codec"
+	"ciphertalk/common/constants"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// bench runs synthetic users against one server
+type bench struct {
+	cfg        config
+	httpClient *http.Client
+	dialer     *websocket.Dialer
+	codec      codec.Codec
+	stats      *stats
+
+	keysMutex sync.Mutex
+	keys      map[string]*keyEntry
+	// pending maps ids of messages in flight to the time they were sent
+	pending sync.Map
+}
+
+func newBench(cfg config, tlsConfig *tls.Config) (*bench, error) {
+	if cfg.Users < 2 {
+		return nil, errors.New("at least 2 users are needed to exchange messages")
+	}
+	if cfg.Rate <= 0 {
+		return nil, errors.New("--rate must be positive")
+	}
+	if cfg.Setup < 1 {
+		cfg.Setup = 1
+	}
+	if _, ok := patterns[cfg.Pattern]; !ok {
+		return nil, fmt.Errorf("unknown pattern %[1]s", cfg.Pattern)
+	}
+	if cfg.Arrival != "constant" && cfg.Arrival != "poisson" {
+		return nil, fmt.Errorf("unknown arrival %[1]s", cfg.Arrival)
+	}
+
+	b := &bench{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig, MaxIdleConnsPerHost: cfg.Setup}},
+		dialer:     &websocket.Dialer{TLSClientConfig: tlsConfig, HandshakeTimeout: 30 * time.Second},
+		stats:      newStats(),
+		keys:       map[string]*keyEntry{},
+	}
+
+	switch cfg.Codec {
+	case "json":
+		b.codec = codec.JSON
+	case "cbor":
+		b.codec = codec.CBOR
+		b.dialer.Subprotocols = []string{constants.WebsocketProtocolCBOR}
+	default:
+		return nil, fmt.Errorf("unknown codec %[1]s", cfg.Codec)
+	}
+
+	return b, nil
+}
+
+func (b *bench) httpURL(path string) string {
+	if b.cfg.TLS {
+		return "https://" + b.cfg.Addr + path
+	}
+	return "http://" + b.cfg.Addr + path
+}
+
+func (b *bench) wsURL(path string) string {
+	if b.cfg.TLS {
+		return "wss://" + b.cfg.Addr + path
+	}
+	return "ws://" + b.cfg.Addr + path
+}
+
+// run sets up all users, lets them send for the configured duration and collects the result
+func (b *bench) run() result {
+	before, err := b.scrapeCounters()
+	if err != nil {
+		log.Println("unable to read server metrics, drops will not be reported:", err)
+	}
+
+	log.Printf("logging in and connecting %[1]d users", b.cfg.Users)
+	start := time.Now()
+	users := b.setup()
+	log.Printf("%[1]d users connected in %[2]v", len(users), time.Since(start).Round(time.Millisecond))
+
+	res := result{cfg: b.cfg, connected: len(users)}
+	if len(users) < 2 {
+		log.Println("not enough users connected to exchange messages")
+		res.stats = b.stats.snapshot()
+		return res
+	}
+
+	var readers sync.WaitGroup
+	for _, u := range users {
+		readers.Add(1)
+		go func(u *user) {
+			defer readers.Done()
+			b.receive(u)
+		}(u)
+	}
+
+	log.Printf("sending for %[1]v", b.cfg.Duration)
+	stop := make(chan struct{})
+	var senders sync.WaitGroup
+	recipient := patterns[b.cfg.Pattern]
+	start = time.Now()
+	for i, u := range users {
+		senders.Add(1)
+		go func(i int, u *user) {
+			defer senders.Done()
+			b.send(u, func(rnd *rand.Rand) *user { return recipient(users, i, rnd) }, stop)
+		}(i, u)
+	}
+
+	time.Sleep(b.cfg.Duration)
+	close(stop)
+	senders.Wait()
+	res.elapsed = time.Since(start)
+
+	b.drain()
+	for _, u := range users {
+		u.conn.Close()
+	}
+	readers.Wait()
+
+	res.stats = b.stats.snapshot()
+	b.pending.Range(func(_, _ interface{}) bool {
+		res.lost++
+		return true
+	})
+
+	if after, err := b.scrapeCounters(); err == nil && before != nil {
+		res.server = after.since(before)
+	}
+	return res
+}
+
+// setup registers, logs in and connects users with a pool of workers, users which fail are left out
+func (b *bench) setup() []*user {
+	users := make([]*user, b.cfg.Users)
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < b.cfg.Setup; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				u, err := b.newUser(fmt.Sprintf("%[1]s-%[2]d", b.cfg.Prefix, i))
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				users[i] = u
+			}
+		}()
+	}
+
+	for i := range users {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	connected := users[:0]
+	for _, u := range users {
+		if u != nil {
+			connected = append(connected, u)
+		}
+	}
+	return connected
+}
+
+// drain waits until every message in flight has arrived or the drain timeout passed
+func (b *bench) drain() {
+	deadline := time.Now().Add(b.cfg.Drain)
+	for time.Now().Before(deadline) {
+		empty := true
+		b.pending.Range(func(_, _ interface{}) bool {
+			empty = false
+			return false
+		})
+		if empty {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// patterns choose the recipient of the next message of user i
+var patterns = map[string]func(users []*user, i int, rnd *rand.Rand) *user{
+	"ring": func(users []*user, i int, rnd *rand.Rand) *user {
+		return users[(i+1)%len(users)]
+	},
+	// pairs talk to each other, the last user of an odd number talks to the first one
+	"pairs": func(users []*user, i int, rnd *rand.Rand) *user {
+		if i%2 == 0 && i+1 < len(users) {
+			return users[i+1]
+		}
+		if i%2 == 1 {
+			return users[i-1]
+		}
+		return users[0]
+	},
+	"random": func(users []*user, i int, rnd *rand.Rand) *user {
+		r := rnd.Intn(len(users) - 1)
+		if r >= i {
+			r++
+		}
+		return users[r]
+	},
+	// fanin sends every message to the first user, which sends to the second one
+	"fanin": func(users []*user, i int, rnd *rand.Rand) *user {
+		if i == 0 {
+			return users[1]
+		}
+		return users[0]
+	},
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"ciphertalk/server"
+	"ciphertalk/server/auth"
+	"ciphertalk/server/controller"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSnapshot_Percentile(t *testing.T) {
+	// arrange
+	snap := snapshot{}
+	for i := 1; i <= 100; i++ {
+		snap.latencies = append(snap.latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	var percentileTable = []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+
+	for _, entry := range percentileTable {
+		// act
+		actual := snap.percentile(entry.p)
+		// assert
+		if actual != entry.expected {
+			t.Errorf("Unexpected p%[1]g. expected: %[2]v, actual: %[3]v", entry.p, entry.expected, actual)
+		}
+	}
+}
+
+func TestPatterns_NeverSelf(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, count := range []int{2, 3, 7} {
+		users := make([]*user, count)
+		for i := range users {
+			users[i] = &user{}
+		}
+
+		for name, recipient := range patterns {
+			for i := range users {
+				// act
+				to := recipient(users, i, rnd)
+				// assert
+				if to == users[i] {
+					t.Errorf("Pattern %[1]s sends to the sender %[2]d of %[3]d users", name, i, count)
+				}
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	// arrange
+	auth.PasswordCost = bcrypt.MinCost
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	handler, ctrl := server.NewHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), server.Config{
+		Validation: controller.Validation{MaxFrameSize: 64 * 1024, MaxBodySize: 32 * 1024},
+	})
+	srv := httptest.NewServer(handler)
+	defer ctrl.Close()
+	defer srv.Close()
+
+	for _, codec := range []string{"json", "cbor"} {
+		b, err := newBench(config{
+			Addr:     strings.TrimPrefix(srv.URL, "http://"),
+			Codec:    codec,
+			Prefix:   "bench-test-" + codec,
+			Password: "bench-password",
+			Users:    8,
+			Setup:    4,
+			Rate:     20,
+			Arrival:  "poisson",
+			Pattern:  "random",
+			Size:     32,
+			Duration: 300 * time.Millisecond,
+			Drain:    5 * time.Second,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// act
+		res := b.run()
+
+		// assert
+		if res.connected != 8 {
+			t.Errorf("Expected all users to connect, got %[1]d", res.connected)
+		}
+		if res.stats.sent == 0 || len(res.stats.latencies) != res.stats.sent || res.lost != 0 {
+			t.Errorf("Expected every message to arrive. sent: %[1]d, received: %[2]d, lost: %[3]d", res.stats.sent, len(res.stats.latencies), res.lost)
+		}
+		if len(res.stats.errors) != 0 {
+			t.Error("Unexpected errors:", res.stats.errors)
+		}
+		if res.server[metricRouted] < float64(res.stats.sent) {
+			t.Errorf("Expected server to route %[1]d messages, got %[2]g", res.stats.sent, res.server[metricRouted])
+		}
+
+		var report bytes.Buffer
+		res.write(&report)
+		if !strings.Contains(report.String(), "p99") {
+			t.Error("Expected report to contain latency percentiles:", report.String())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Command ciphertalk-bench measures how many concurrent users a server sustains. It logs in synthetic users,
+// opens their websockets and exchanges encrypted messages between them, then reports latency percentiles,
+// throughput, client-side errors and the messages the server dropped.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+// config holds the settings of a benchmark run
+type config struct {
+	Addr     string
+	TLS      bool
+	Insecure bool
+	Codec    string
+	// Prefix is prepended to the names of synthetic users, every run gets fresh accounts by default
+	Prefix   string
+	Password string
+	Users    int
+	// Setup is the number of users registered, logged in and connected at the same time
+	Setup int
+	// Rate is the number of messages per second sent by every user
+	Rate float64
+	// Arrival spaces messages of a user evenly (constant) or randomly (poisson)
+	Arrival string
+	// Pattern chooses recipients: ring, pairs, random or fanin
+	Pattern  string
+	Size     int
+	Duration time.Duration
+	// Drain is how long the run waits for messages in flight after the last one was sent
+	Drain time.Duration
+}
+
+var cfg config
+
+func init() {
+	flag.StringVar(&cfg.Addr, "addr", "localhost:3000", "http service address")
+	flag.BoolVar(&cfg.TLS, "tls", false, "connect with https and wss")
+	flag.BoolVar(&cfg.Insecure, "insecure", false, "skip verification of the server's certificate, e.g. for --tls-self-signed")
+	flag.StringVar(&cfg.Codec, "codec", "json", "websocket frame codec: json or cbor")
+	flag.StringVar(&cfg.Prefix, "prefix", "", "name prefix of synthetic users, random when empty")
+	flag.StringVar(&cfg.Password, "password", "bench-password", "password of synthetic users")
+	flag.IntVar(&cfg.Users, "users", 100, "number of synthetic users")
+	flag.IntVar(&cfg.Setup, "setup-concurrency", 50, "users logging in and connecting at the same time")
+	flag.Float64Var(&cfg.Rate, "rate", 1, "messages per second sent by every user")
+	flag.StringVar(&cfg.Arrival, "arrival", "constant", "spacing of messages: constant or poisson")
+	flag.StringVar(&cfg.Pattern, "pattern", "ring", "recipients: ring (next user), pairs, random or fanin (everybody to the first user)")
+	flag.IntVar(&cfg.Size, "size", 64, "plaintext bytes per message")
+	flag.DurationVar(&cfg.Duration, "duration", 30*time.Second, "how long users send messages")
+	flag.DurationVar(&cfg.Drain, "drain", 5*time.Second, "how long to wait for messages in flight after sending stopped")
+}
+
+func main() {
+	flag.Parse()
+
+	if cfg.Prefix == "" {
+		id := make([]byte, 3)
+		rand.Read(id)
+		cfg.Prefix = "bench-" + hex.EncodeToString(id)
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: cfg.Insecure}
+	}
+
+	b, err := newBench(cfg, tlsConfig)
+	if err != nil {
+		log.Fatal("invalid configuration: ", err)
+	}
+
+	result := b.run()
+	result.write(os.Stdout)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// server metrics reported after a run
+const (
+	metricRouted  = "ciphertalk_messages_routed_total"
+	metricQueued  = "ciphertalk_messages_queued_total"
+	metricDropped = "ciphertalk_messages_dropped_total"
+)
+
+// counters holds values of the server's unlabeled counters by name
+type counters map[string]float64
+
+// since returns how much every counter grew after previous
+func (c counters) since(previous counters) counters {
+	delta := counters{}
+	for name, value := range c {
+		delta[name] = value - previous[name]
+	}
+	return delta
+}
+
+// scrapeCounters reads message counters from the server's Prometheus endpoint
+func (b *bench) scrapeCounters() (counters, error) {
+	resp, err := b.httpClient.Get(b.httpURL("/metrics"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /metrics returned %[1]d", resp.StatusCode)
+	}
+
+	result := counters{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case metricRouted, metricQueued, metricDropped:
+			if value, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				result[fields[0]] = value
+			}
+		}
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stats collects what users observe during a run
+type stats struct {
+	mutex     sync.Mutex
+	sentCount int
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+func newStats() *stats {
+	return &stats{errors: map[string]int{}}
+}
+
+func (s *stats) sent() {
+	s.mutex.Lock()
+	s.sentCount++
+	s.mutex.Unlock()
+}
+
+// received records the time between sending and receiving a message
+func (s *stats) received(latency time.Duration) {
+	s.mutex.Lock()
+	s.latencies = append(s.latencies, latency)
+	s.mutex.Unlock()
+}
+
+// fail counts an error of the given kind
+func (s *stats) fail(kind string) {
+	s.mutex.Lock()
+	s.errors[kind]++
+	s.mutex.Unlock()
+}
+
+// snapshot copies the stats with sorted latencies
+func (s *stats) snapshot() snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snap := snapshot{
+		sent:      s.sentCount,
+		latencies: append([]time.Duration(nil), s.latencies...),
+		errors:    map[string]int{},
+	}
+	for kind, count := range s.errors {
+		snap.errors[kind] = count
+	}
+	sort.Slice(snap.latencies, func(i, j int) bool { return snap.latencies[i] < snap.latencies[j] })
+	return snap
+}
+
+type snapshot struct {
+	sent      int
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+// percentile returns the latency below which p percent of messages arrived
+func (s snapshot) percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+
+	i := int(p/100*float64(len(s.latencies))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(s.latencies) {
+		i = len(s.latencies) - 1
+	}
+	return s.latencies[i]
+}
+
+// result is the report of a run
+type result struct {
+	cfg       config
+	connected int
+	elapsed   time.Duration
+	stats     snapshot
+	// lost counts messages which were sent but never arrived, including messages rejected by the server
+	lost   int
+	server counters
+}
+
+func (r result) write(w io.Writer) {
+	received := len(r.stats.latencies)
+	seconds := r.elapsed.Seconds()
+	if seconds == 0 {
+		seconds = 1
+	}
+
+	fmt.Fprintf(w, "users        %[1]d connected of %[2]d, pattern %[3]s, %[4]g msg/s each (%[5]s), %[6]s frames\n",
+		r.connected, r.cfg.Users, r.cfg.Pattern, r.cfg.Rate, r.cfg.Arrival, r.cfg.Codec)
+	fmt.Fprintf(w, "messages     %[1]d sent, %[2]d received, %[3]d lost\n", r.stats.sent, received, r.lost)
+	fmt.Fprintf(w, "throughput   %.1[1]f msg/s sent, %.1[2]f msg/s received over %[3]v\n",
+		float64(r.stats.sent)/seconds, float64(received)/seconds, r.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "latency      p50 %[1]v, p90 %[2]v, p99 %[3]v, max %[4]v\n",
+		r.stats.percentile(50), r.stats.percentile(90), r.stats.percentile(99), r.stats.percentile(100))
+	fmt.Fprintf(w, "errors       %[1]s\n", formatErrors(r.stats.errors))
+
+	if r.server == nil {
+		fmt.Fprintln(w, "server       metrics unavailable")
+		return
+	}
+	fmt.Fprintf(w, "server       %[1]g routed, %[2]g queued, %[3]g dropped\n",
+		r.server[metricRouted], r.server[metricQueued], r.server[metricDropped])
+}
+
+func formatErrors(errors map[string]int) string {
+	if len(errors) == 0 {
+		return "none"
+	}
+
+	kinds := make([]string, 0, len(errors))
+	for kind := range errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%[1]s: %[2]d", kind, errors[kind])
+	}
+	return strings.Join(parts, ", ")
+}
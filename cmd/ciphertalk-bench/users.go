@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"ciphertalk/common/constants"
+	"ciphertalk/common/envelope"
+	"ciphertalk/common/models"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// how often rate limited requests are retried before the user counts as failed
+const maxRetries = 5
+
+// user is a synthetic client which encrypts with the Go client's envelope package
+type user struct {
+	name                  string
+	token                 string
+	publicKey, privateKey *[32]byte
+
+	conn *websocket.Conn
+	// websocket connections support only one concurrent writer
+	writeMutex sync.Mutex
+}
+
+// newUser registers, logs in and connects a user
+func (b *bench) newUser(name string) (*user, error) {
+	u := &user{name: name}
+
+	var err error
+	if u.publicKey, u.privateKey, err = box.GenerateKey(crand.Reader); err != nil {
+		return nil, err
+	}
+
+	status, err := b.post("/register", "", models.RegisterRequest{UserName: name, Password: b.cfg.Password}, nil)
+	if err != nil && status != http.StatusConflict {
+		b.stats.fail("register")
+		return nil, fmt.Errorf("unable to register %[1]s: %[2]v", name, err)
+	}
+
+	var login models.LoginResponse
+	if _, err = b.post("/login", "", models.LoginRequest{UserName: name, Password: b.cfg.Password, PublicKey: *u.publicKey}, &login); err != nil {
+		b.stats.fail("login")
+		return nil, fmt.Errorf("unable to login %[1]s: %[2]v", name, err)
+	}
+	u.token = login.AuthToken
+
+	if err = b.connect(u); err != nil {
+		b.stats.fail("connect")
+		return nil, fmt.Errorf("unable to connect %[1]s: %[2]v", name, err)
+	}
+
+	return u, nil
+}
+
+// post sends a JSON request, rate limited requests are retried after the time the server asks for
+func (b *bench) post(path string, token string, body interface{}, v interface{}) (int, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, _ := http.NewRequest(constants.HTTPPost, b.httpURL(path), bytes.NewReader(payload))
+		req.Header.Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+		if token != "" {
+			req.Header.Set(constants.HTTPAuthorization, "Bearer "+token)
+		}
+
+		resp, err := b.httpClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			resp.Body.Close()
+			time.Sleep(retryAfter(resp))
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			message, _ := io.ReadAll(resp.Body)
+			return resp.StatusCode, fmt.Errorf("%[1]d %[2]s", resp.StatusCode, strings.TrimSpace(string(message)))
+		}
+
+		if v != nil {
+			return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+		}
+		return resp.StatusCode, nil
+	}
+}
+
+// connect opens the user's websocket, rate limited upgrades are retried like requests
+func (b *bench) connect(u *user) error {
+	headers := http.Header{constants.HTTPAuthorization: {"Bearer " + u.token}}
+
+	for attempt := 1; ; attempt++ {
+		conn, resp, err := b.dialer.Dial(b.wsURL("/websockets"), headers)
+		if err == nil {
+			if b.codec.Binary() && conn.Subprotocol() != constants.WebsocketProtocolCBOR {
+				conn.Close()
+				return errors.New("server does not support CBOR frames")
+			}
+			u.conn = conn
+			return nil
+		}
+
+		if resp == nil || resp.StatusCode != http.StatusTooManyRequests || attempt == maxRetries {
+			return err
+		}
+		time.Sleep(retryAfter(resp))
+	}
+}
+
+// retryAfter returns the delay requested by a rate limited response with some jitter to spread out retries
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 1 {
+		seconds = 1
+	}
+	return time.Duration(seconds)*time.Second + time.Duration(rand.Int63n(int64(time.Second)))
+}
+
+// lookupKey returns the public key of name from /secure. Keys are shared by all users of the run, so every
+// key is looked up once and later messages measure the server rather than lookups.
+func (b *bench) lookupKey(u *user, name string) (*[32]byte, error) {
+	b.keysMutex.Lock()
+	entry, ok := b.keys[name]
+	if !ok {
+		entry = &keyEntry{ready: make(chan struct{})}
+		b.keys[name] = entry
+	}
+	b.keysMutex.Unlock()
+
+	if ok {
+		<-entry.ready
+		return entry.key, entry.err
+	}
+
+	var res models.ChannelResponse
+	if _, entry.err = b.post("/secure", u.token, models.ChannelRequest{UserName: name}, &res); entry.err == nil {
+		key := [32]byte(res.PublicKey)
+		entry.key = &key
+	} else {
+		// failed lookups are not cached
+		b.keysMutex.Lock()
+		delete(b.keys, name)
+		b.keysMutex.Unlock()
+	}
+	close(entry.ready)
+	return entry.key, entry.err
+}
+
+// keyEntry is a public key which is being looked up or has been found
+type keyEntry struct {
+	ready chan struct{}
+	key   *[32]byte
+	err   error
+}
+
+// send encrypts and sends messages at the configured rate until stop is closed
+func (b *bench) send(u *user, recipient func(rnd *rand.Rand) *user, stop <-chan struct{}) {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	text := strings.Repeat("x", b.cfg.Size)
+	interval := time.Duration(float64(time.Second) / b.cfg.Rate)
+
+	// users start at random offsets so they do not send in lockstep
+	timer := time.NewTimer(time.Duration(rnd.Int63n(int64(interval))))
+	defer timer.Stop()
+
+	for seq := 0; ; seq++ {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		next := interval
+		if b.cfg.Arrival == "poisson" {
+			next = time.Duration(rnd.ExpFloat64() * float64(interval))
+		}
+		timer.Reset(next)
+
+		to := recipient(rnd)
+		key, err := b.lookupKey(u, to.name)
+		if err != nil {
+			b.stats.fail("lookup")
+			continue
+		}
+
+		msg, err := envelope.Seal(models.Payload{ID: fmt.Sprintf("%[1]s-%[2]d", u.name, seq), Text: text}, u.name, to.name, key, u.privateKey, time.Now())
+		if err != nil {
+			b.stats.fail("encrypt")
+			continue
+		}
+
+		data, err := b.codec.Marshal(msg)
+		if err != nil {
+			b.stats.fail("encrypt")
+			continue
+		}
+
+		frameType := websocket.TextMessage
+		if b.codec.Binary() {
+			frameType = websocket.BinaryMessage
+		}
+
+		b.pending.Store(msg.ID, time.Now())
+		u.writeMutex.Lock()
+		err = u.conn.WriteMessage(frameType, data)
+		u.writeMutex.Unlock()
+
+		if err != nil {
+			b.pending.Delete(msg.ID)
+			b.stats.fail("send")
+			return
+		}
+		b.stats.sent()
+	}
+}
+
+// receive reads frames until the connection closes, decrypts messages and records their latency
+func (b *bench) receive(u *user) {
+	for {
+		_, data, err := u.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		received := time.Now()
+
+		var errFrame models.ErrorFrame
+		if b.codec.Unmarshal(data, &errFrame) == nil && errFrame.Error != "" {
+			b.stats.fail(fmt.Sprintf("error frame %[1]d", errFrame.Code))
+			continue
+		}
+
+		var msg models.Message
+		if err = b.codec.Unmarshal(data, &msg); err != nil {
+			b.stats.fail("decode")
+			continue
+		}
+
+		sent, ok := b.pending.LoadAndDelete(msg.ID)
+		if !ok {
+			b.stats.fail("unexpected message")
+			continue
+		}
+
+		key, err := b.lookupKey(u, msg.SenderID)
+		if err != nil {
+			b.stats.fail("lookup")
+			continue
+		}
+
+		if _, err = envelope.Open(msg, key, u.privateKey); err != nil {
+			b.stats.fail("decrypt")
+			continue
+		}
+
+		b.stats.received(received.Sub(sent.(time.Time)))
+	}
+}
@@ -0,0 +1,63 @@
+// Package codec encodes websocket frames. JSON is the default, clients which negotiate
+// constants.WebsocketProtocolCBOR exchange CBOR in binary frames, where message bodies, nonces and keys
+// are byte strings instead of base64 strings and integer arrays.
+package codec
+
+import (
+	"encoding/json"
+
+	"ciphertalk/common/constants"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Codec marshals frames sent over a websocket
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	// Binary reports whether frames are sent as binary websocket messages instead of text
+	Binary() bool
+}
+
+// JSON encodes frames as JSON text
+var JSON Codec = jsonCodec{}
+
+// CBOR encodes frames as CBOR, field names are the same as in JSON
+var CBOR Codec = cborCodec{}
+
+// ForProtocol returns the codec of a negotiated websocket subprotocol, JSON when none was negotiated
+func ForProtocol(protocol string) Codec {
+	if protocol == constants.WebsocketProtocolCBOR {
+		return CBOR
+	}
+
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Binary() bool {
+	return false
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
+
+func (cborCodec) Binary() bool {
+	return true
+}
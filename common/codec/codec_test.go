@@ -0,0 +1,121 @@
+package codec
+
+import (
+	"bytes"
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"testing"
+	"time"
+)
+
+func sampleMessage() models.Message {
+	var nonce [24]byte
+	for i := range nonce {
+		nonce[i] = byte(200 + i)
+	}
+
+	return models.Message{
+		ID:          "0123456789abcdef0123456789abcdef",
+		SenderID:    "foo",
+		RecipientID: "bar",
+		Body:        bytes.Repeat([]byte{0xfe}, 256),
+		TimeStamp:   time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC).Format(constants.TimeStampFormat),
+		MsgNonce:    nonce,
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	var codecTable = []struct {
+		name  string
+		codec Codec
+	}{
+		{"json", JSON},
+		{"cbor", CBOR},
+	}
+
+	for _, entry := range codecTable {
+		// arrange
+		msg := sampleMessage()
+
+		// act
+		data, err := entry.codec.Marshal(msg)
+		var decoded models.Message
+		if err == nil {
+			err = entry.codec.Unmarshal(data, &decoded)
+		}
+
+		// assert
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", entry.name, err)
+		}
+		if decoded.MsgNonce != msg.MsgNonce || !bytes.Equal(decoded.Body, msg.Body) || decoded.ID != msg.ID || decoded.TimeStamp != msg.TimeStamp {
+			t.Errorf("%v: expected %v, got %v", entry.name, msg, decoded)
+		}
+	}
+}
+
+func TestCBOR_ErrorFrame(t *testing.T) {
+	// arrange
+	data, _ := CBOR.Marshal(sampleMessage())
+
+	// act
+	var frame models.ErrorFrame
+	err := CBOR.Unmarshal(data, &frame)
+
+	// assert
+	if err != nil || frame.Error != "" {
+		t.Errorf("Expected message to decode as empty error frame, got %v %v", frame, err)
+	}
+}
+
+func TestCBOR_Smaller(t *testing.T) {
+	// arrange
+	msg := sampleMessage()
+
+	// act
+	jsonFrame, _ := JSON.Marshal(msg)
+	cborFrame, _ := CBOR.Marshal(msg)
+
+	// assert
+	// CBOR frames are expected to be at least a fifth smaller than JSON
+	if len(cborFrame) >= len(jsonFrame)*4/5 {
+		t.Errorf("Expected CBOR frame to be at least a fifth smaller than JSON, got %v and %v bytes", len(cborFrame), len(jsonFrame))
+	}
+}
+
+func TestForProtocol(t *testing.T) {
+	if ForProtocol(constants.WebsocketProtocolCBOR) != CBOR || !CBOR.Binary() {
+		t.Error("Expected binary CBOR codec for", constants.WebsocketProtocolCBOR)
+	}
+
+	if ForProtocol(constants.WebsocketProtocol) != JSON || ForProtocol("") != JSON || JSON.Binary() {
+		t.Error("Expected JSON text codec by default")
+	}
+}
+
+func benchmarkMarshal(b *testing.B, codec Codec) {
+	msg := sampleMessage()
+	data, _ := codec.Marshal(msg)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		codec.Marshal(msg)
+	}
+	b.ReportMetric(float64(len(data)), "bytes/frame")
+}
+
+func benchmarkUnmarshal(b *testing.B, codec Codec) {
+	data, _ := codec.Marshal(sampleMessage())
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var msg models.Message
+		codec.Unmarshal(data, &msg)
+	}
+	b.ReportMetric(float64(len(data)), "bytes/frame")
+}
+
+func BenchmarkJSON_Marshal(b *testing.B)   { benchmarkMarshal(b, JSON) }
+func BenchmarkCBOR_Marshal(b *testing.B)   { benchmarkMarshal(b, CBOR) }
+func BenchmarkJSON_Unmarshal(b *testing.B) { benchmarkUnmarshal(b, JSON) }
+func BenchmarkCBOR_Unmarshal(b *testing.B) { benchmarkUnmarshal(b, CBOR) }
@@ -1,10 +1,27 @@
 package constants
 
+import "time"
+
 // Common HTTP verbs
 const HTTPGet = "GET"
 const HTTPPost = "POST"
+const HTTPPut = "PUT"
+const HTTPDelete = "DELETE"
+const HTTPOptions = "OPTIONS"
 
 // Common HTTP header names and values
 const HTTPContentType = "Content-Type"
 const HTTPApplicationJSON = "application/json; charset=UTF-8"
+const HTTPOctetStream = "application/octet-stream"
 const HTTPAuthorization = "Authorization"
+
+// Websocket subprotocol spoken on /websockets. Browsers can not set the Authorization header on the upgrade request,
+// so they offer the token as an additional subprotocol with WebsocketTokenPrefix.
+const WebsocketProtocol = "ciphertalk"
+const WebsocketTokenPrefix = "bearer."
+
+// Websocket subprotocol which exchanges CBOR in binary frames instead of JSON, see package codec
+const WebsocketProtocolCBOR = "ciphertalk.cbor"
+
+// Format of models.Message.TimeStamp
+const TimeStampFormat = time.RFC3339Nano
@@ -0,0 +1,60 @@
+package envelope
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// ErrDecrypt is returned when a message body can not be opened with the given keys
+var ErrDecrypt = errors.New("unable to decrypt message")
+
+// NewMessageID returns a random message id
+func NewMessageID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Seal encrypts payload from sender to recipient with NaCl box and wraps it in an envelope time stamped with t.
+// Payloads without an id get a random one, the envelope carries the same id and the id a delete retracts.
+func Seal(payload models.Payload, sender string, recipient string, recipientKey *[32]byte, privateKey *[32]byte, t time.Time) (models.Message, error) {
+	if payload.ID == "" {
+		payload.ID = NewMessageID()
+	}
+
+	plain, err := models.EncodePayload(payload)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	var nonce [24]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return models.Message{}, err
+	}
+
+	return models.Message{
+		ID:          payload.ID,
+		SenderID:    sender,
+		RecipientID: recipient,
+		Body:        box.Seal(nil, plain, &nonce, recipientKey, privateKey),
+		TimeStamp:   t.UTC().Format(constants.TimeStampFormat),
+		MsgNonce:    nonce,
+		Retracts:    payload.Delete,
+	}, nil
+}
+
+// Open decrypts the body of msg sent with senderKey and decodes its payload
+func Open(msg models.Message, senderKey *[32]byte, privateKey *[32]byte) (models.Payload, error) {
+	plain, ok := box.Open(nil, msg.Body, (*[24]byte)(&msg.MsgNonce), senderKey, privateKey)
+	if !ok {
+		return models.Payload{}, ErrDecrypt
+	}
+
+	return models.DecodePayload(plain), nil
+}
@@ -0,0 +1,30 @@
+package envelope
+
+import (
+	"ciphertalk/common/models"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	// arrange
+	alicePublic, alicePrivate, _ := box.GenerateKey(rand.Reader)
+	bobPublic, bobPrivate, _ := box.GenerateKey(rand.Reader)
+	// act
+	msg, err := Seal(models.Payload{Text: "secret"}, "alice", "bob", bobPublic, alicePrivate, time.Now())
+	if err != nil {
+		t.Fatal("Unable to seal:", err)
+	}
+	payload, err := Open(msg, alicePublic, bobPrivate)
+	// assert
+	if err != nil || payload.Text != "secret" || payload.ID != msg.ID || msg.ID == "" {
+		t.Errorf("Unexpected payload: %+v %v", payload, err)
+	}
+
+	if _, err = Open(msg, bobPublic, bobPrivate); err != ErrDecrypt {
+		t.Errorf("Message opened with the wrong key: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ContentVersion is the version of Payload encoding written by EncodePayload.
+// Version 0 are payloads of clients which did not set a version or sent plain text.
+const ContentVersion = 1
+
+// Content types of Payload
+const (
+	ContentText     = "text"
+	ContentReply    = "reply"
+	ContentReaction = "reaction"
+	ContentFile     = "file"
+	ContentEdit     = "edit"
+	ContentDelete   = "delete"
+	ContentSignal   = "signal"
+)
+
+// Signals sent in Payload.Signal of ephemeral messages
+const (
+	SignalTyping        = "typing"
+	SignalStoppedTyping = "stopped-typing"
+	SignalFocused       = "focused"
+	SignalUnfocused     = "unfocused"
+)
+
+// Payload is the plaintext sealed inside Message body. It is never visible to the server.
+// Every payload should carry Text which clients that don't understand its Type can display instead.
+type Payload struct {
+	Version int    `json:"v,omitempty"`
+	Type    string `json:"type,omitempty"`
+	// ID is the id of this message, it mirrors Message.ID but can not be changed by the server
+	ID   string        `json:"id,omitempty"`
+	Text string        `json:"text,omitempty"`
+	File *FileManifest `json:"file,omitempty"`
+	// Signal is set on ephemeral messages instead of Text or File
+	Signal string `json:"signal,omitempty"`
+	// Edit is the id of an earlier message whose text is replaced with Text
+	Edit string `json:"edit,omitempty"`
+	// Delete is the id of an earlier message which is removed
+	Delete string `json:"delete,omitempty"`
+	// ReplyTo is the id of the message this one replies to
+	ReplyTo string `json:"replyTo,omitempty"`
+	// Reaction is set on reaction content
+	Reaction *Reaction `json:"reaction,omitempty"`
+	// ExpiresAt is unix time after which recipient deletes the message, zero means it never expires
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+// Reaction adds or removes an emoji on an earlier message
+type Reaction struct {
+	MessageID string `json:"messageId"`
+	Emoji     string `json:"emoji"`
+	Remove    bool   `json:"remove,omitempty"`
+}
+
+// EncodePayload stamps payload with the current version, infers its type and adds text for clients
+// which can not display the content type
+func EncodePayload(payload Payload) ([]byte, error) {
+	payload.Version = ContentVersion
+
+	if payload.Type == "" {
+		payload.Type = inferType(payload)
+	}
+
+	if payload.Type == ContentReaction && payload.Text == "" && payload.Reaction != nil {
+		payload.Text = "reacted " + payload.Reaction.Emoji
+		if payload.Reaction.Remove {
+			payload.Text = "removed reaction " + payload.Reaction.Emoji
+		}
+	}
+
+	return json.Marshal(payload)
+}
+
+// DecodePayload parses decrypted message body. Bodies sent by older clients are treated as plain text
+// and unversioned payloads get their type inferred from the fields they carry.
+func DecodePayload(body []byte) Payload {
+	var payload Payload
+	if !strings.HasPrefix(strings.TrimSpace(string(body)), "{") || json.Unmarshal(body, &payload) != nil {
+		return Payload{Type: ContentText, Text: string(body)}
+	}
+
+	if payload.Version == 0 && payload.Text == "" && payload.File == nil && payload.Signal == "" && payload.Delete == "" {
+		return Payload{Type: ContentText, Text: string(body)}
+	}
+
+	if payload.Type == "" {
+		payload.Type = inferType(payload)
+	}
+
+	return payload
+}
+
+func inferType(payload Payload) string {
+	switch {
+	case payload.Signal != "":
+		return ContentSignal
+	case payload.Delete != "":
+		return ContentDelete
+	case payload.Edit != "":
+		return ContentEdit
+	case payload.Reaction != nil:
+		return ContentReaction
+	case payload.File != nil:
+		return ContentFile
+	case payload.ReplyTo != "":
+		return ContentReply
+	}
+
+	return ContentText
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var decodePayloadTable = []struct {
+	body        string
+	contentType string
+	text        string
+}{
+	{`{"text":"hello","expiresAt":10}`, ContentText, "hello"},
+	{"plain text from an older client", ContentText, "plain text from an older client"},
+	{"{}", ContentText, "{}"},
+	{`{"signal":"typing"}`, ContentSignal, ""},
+	{`{"delete":"1"}`, ContentDelete, ""},
+	{`{"v":1,"type":"reply","text":"yes","replyTo":"1"}`, ContentReply, "yes"},
+	{`{"v":2,"type":"poll","text":"vote now"}`, "poll", "vote now"},
+}
+
+func TestDecodePayload(t *testing.T) {
+	for _, entry := range decodePayloadTable {
+		payload := DecodePayload([]byte(entry.body))
+
+		if payload.Type != entry.contentType {
+			t.Errorf("Unexpected type of %v. expected: %v, actual: %v", entry.body, entry.contentType, payload.Type)
+		}
+
+		if payload.Text != entry.text {
+			t.Errorf("Unexpected text of %v. expected: %v, actual: %v", entry.body, entry.text, payload.Text)
+		}
+	}
+}
+
+func TestEncodePayload_RoundTrip(t *testing.T) {
+	// arrange
+	original := Payload{ID: "2", Text: "agreed", ReplyTo: "1"}
+	// act
+	body, err := EncodePayload(original)
+	result := DecodePayload(body)
+	// assert
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Version != ContentVersion || result.Type != ContentReply || result.ReplyTo != "1" {
+		t.Errorf("Unexpected payload: %+v", result)
+	}
+}
+
+func TestEncodePayload_ReactionFallbackText(t *testing.T) {
+	// arrange
+	reaction := Payload{Reaction: &Reaction{MessageID: "1", Emoji: "+1"}}
+	// act
+	body, _ := EncodePayload(reaction)
+	// assert
+	var legacy struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal(body, &legacy)
+
+	if legacy.Text == "" {
+		t.Error("Reaction should carry text for clients which do not understand reactions")
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Key32 is a 32 byte key, encoded in JSON as an unpadded base64url string.
+// Arrays of numbers written by older clients are accepted when decoding.
+type Key32 [32]byte
+
+// Nonce24 is a 24 byte nonce, encoded in JSON like Key32
+type Nonce24 [24]byte
+
+// MarshalJSON encodes the key as a base64url string
+func (k Key32) MarshalJSON() ([]byte, error) {
+	return marshalFixed(k[:])
+}
+
+// UnmarshalJSON decodes a base64url string or an array of 32 numbers
+func (k *Key32) UnmarshalJSON(data []byte) error {
+	return unmarshalFixed(data, k[:], "key")
+}
+
+// MarshalJSON encodes the nonce as a base64url string
+func (n Nonce24) MarshalJSON() ([]byte, error) {
+	return marshalFixed(n[:])
+}
+
+// UnmarshalJSON decodes a base64url string or an array of 24 numbers
+func (n *Nonce24) UnmarshalJSON(data []byte) error {
+	return unmarshalFixed(data, n[:], "nonce")
+}
+
+func marshalFixed(b []byte) ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func unmarshalFixed(data []byte, dst []byte, name string) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var decoded []byte
+	if len(data) > 0 && data[0] == '[' {
+		var numbers []uint8
+		if err := json.Unmarshal(data, &numbers); err != nil {
+			return fmt.Errorf("invalid %[1]s: %[2]v", name, err)
+		}
+		decoded = numbers
+	} else {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return errors.New("invalid " + name + ": expected base64url string or array of numbers")
+		}
+
+		var err error
+		if decoded, err = base64.RawURLEncoding.Strict().DecodeString(text); err != nil {
+			return fmt.Errorf("invalid %[1]s: %[2]v", name, err)
+		}
+	}
+
+	if len(decoded) != len(dst) {
+		return fmt.Errorf("invalid %[1]s: expected %[2]d bytes, got %[3]d", name, len(dst), len(decoded))
+	}
+
+	copy(dst, decoded)
+	return nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestKey32_MarshalJSON(t *testing.T) {
+	// arrange
+	var key Key32
+	for i := range key {
+		key[i] = 0xff
+	}
+	// act
+	data, err := json.Marshal(ChannelResponse{PublicKey: key})
+	// assert
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	expected := `{"publicKey":"` + strings.Repeat("_", 42) + `8"}`
+	if string(data) != expected {
+		t.Errorf("Unexpected JSON. expected: %v, actual: %v", expected, string(data))
+	}
+}
+
+var unmarshalNonceTable = []struct {
+	json  string
+	valid bool
+	first byte
+}{
+	{`"` + strings.Repeat("AQ", 16) + `"`, true, 0x01},
+	{`[` + strings.Repeat("7,", 23) + `7]`, true, 7},
+	{`null`, true, 0},
+	{`"` + strings.Repeat("AQ", 15) + `"`, false, 0},
+	{`"` + strings.Repeat("AQ", 16) + `=="`, false, 0},
+	{`"` + strings.Repeat("+/", 16) + `"`, false, 0},
+	{`[` + strings.Repeat("7,", 22) + `7]`, false, 0},
+	{`[` + strings.Repeat("7,", 23) + `256]`, false, 0},
+	{`42`, false, 0},
+}
+
+func TestNonce24_UnmarshalJSON(t *testing.T) {
+	for _, entry := range unmarshalNonceTable {
+		// act
+		var nonce Nonce24
+		err := json.Unmarshal([]byte(entry.json), &nonce)
+
+		// assert
+		if (err == nil) != entry.valid {
+			t.Errorf("Unexpected result for %v. expected valid: %v, actual error: %v", entry.json, entry.valid, err)
+		}
+
+		if entry.valid && nonce[0] != entry.first {
+			t.Errorf("Unexpected nonce for %v: %v", entry.json, nonce)
+		}
+	}
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+	// arrange
+	original := Message{SenderID: "foo", RecipientID: "bar", Body: []byte("secret"), MsgNonce: Nonce24{1, 2, 3}}
+	// act
+	data, _ := json.Marshal(original)
+	var decoded Message
+	err := json.Unmarshal(data, &decoded)
+	// assert
+	if err != nil || decoded.MsgNonce != original.MsgNonce {
+		t.Errorf("Unexpected round trip of %s: %v %v", data, decoded.MsgNonce, err)
+	}
+}
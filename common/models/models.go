@@ -1,18 +1,41 @@
 package models
 
-// Message sent from client to server and transmitted to final recepient
+// Message sent from client to server and transmitted to final recepient.
+// Sealed messages have no SenderID and TimeStamp, their Body is an anonymous box with SealedContent
+// and Certificate authorizes the delivery.
+// TTL is an advisory lifetime in seconds mirroring Payload.ExpiresAt, the server purges queued copies after it.
+// Ephemeral messages carry signals such as typing indicators, they are relayed only to online recipients
+// and are never queued.
+// ID is a random message id chosen by the sender. Retracts is set on delete operations to the id of the deleted
+// message, so the server can remove it from the offline queue.
 type Message struct {
-	SenderID    string   `json:"senderId"`
-	RecipientID string   `json:"recepientId"`
-	Body        []byte   `json:"body"`
-	TimeStamp   string   `json:"timeStamp"`
-	MsgNonce    [24]byte `json:"msgNonce"`
+	ID          string  `json:"id,omitempty"`
+	SenderID    string  `json:"senderId"`
+	RecipientID string  `json:"recepientId"`
+	Body        []byte  `json:"body"`
+	TimeStamp   string  `json:"timeStamp"`
+	MsgNonce    Nonce24 `json:"msgNonce"`
+	Sealed      bool    `json:"sealed,omitempty"`
+	Certificate string  `json:"certificate,omitempty"`
+	TTL         int64   `json:"ttl,omitempty"`
+	Ephemeral   bool    `json:"ephemeral,omitempty"`
+	Retracts    string  `json:"retracts,omitempty"`
+}
+
+// MaxMessageIDLength is the longest message id accepted by the server
+const MaxMessageIDLength = 64
+
+// RegisterRequest is sent from client to create an account
+type RegisterRequest struct {
+	UserName string `json:"userName"`
+	Password string `json:"password"`
 }
 
 // LoginRequest is sent from client with loging request
 type LoginRequest struct {
-	UserName  string   `json:"userName"`
-	PublicKey [32]byte `json:"publicKey"`
+	UserName  string `json:"userName"`
+	Password  string `json:"password"`
+	PublicKey Key32  `json:"publicKey"`
 }
 
 // LoginResponse is sent from server in event of successful login
@@ -20,6 +43,12 @@ type LoginResponse struct {
 	AuthToken string `json:"authToken"`
 }
 
+// TokenRequest is sent to the admin API to issue a token with specific scopes for a user
+type TokenRequest struct {
+	UserName string   `json:"userName"`
+	Scopes   []string `json:"scopes"`
+}
+
 // ChannelRequest is sent from client and contains username of another client for whom the channel is being requested
 type ChannelRequest struct {
 	UserName string `json:"userName"`
@@ -27,5 +56,58 @@ type ChannelRequest struct {
 
 // ChannelResponse is sent from server and contains public key for the request client
 type ChannelResponse struct {
-	PublicKey [32]byte `json:"publicKey"`
+	PublicKey Key32 `json:"publicKey"`
+}
+
+// ErrorFrame is sent from server via websocket when a message from client has been rejected
+type ErrorFrame struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// FileManifest is sent inside Payload and describes a file uploaded to the server as encrypted chunks.
+// Every chunk is encrypted with Key using secretbox and stored on the server under sha256 of the ciphertext.
+type FileManifest struct {
+	Name   string   `json:"name"`
+	Size   int64    `json:"size"`
+	Key    Key32    `json:"key"`
+	Hash   string   `json:"hash"`
+	Chunks []string `json:"chunks"`
+}
+
+// DeliveryCertificateResponse is sent from server and contains a short-lived certificate for sending sealed sender messages
+type DeliveryCertificateResponse struct {
+	Certificate string `json:"certificate"`
+	Expires     int64  `json:"expires"`
+}
+
+// WebsocketTicketResponse is sent from server and contains a single-use ticket for opening a websocket from a browser
+type WebsocketTicketResponse struct {
+	Ticket  string `json:"ticket"`
+	Expires int64  `json:"expires"`
+}
+
+// SealedContent is encrypted to the recipient with an anonymous box and sent as Message body when sealed sender is used.
+// It hides sender identity and timestamp from the server, Body and MsgNonce are the regular box sealed by the sender.
+type SealedContent struct {
+	SenderID  string  `json:"senderId"`
+	TimeStamp string  `json:"timeStamp"`
+	Body      []byte  `json:"body"`
+	MsgNonce  Nonce24 `json:"msgNonce"`
+}
+
+// UserSummary is returned from the admin API and describes a user in the key directory
+type UserSummary struct {
+	UserName    string `json:"userName"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Banned      bool   `json:"banned"`
+	Sessions    int    `json:"sessions"`
+}
+
+// SessionSummary is returned from the admin API and describes a connected websocket session
+type SessionSummary struct {
+	ID          string `json:"id"`
+	UserName    string `json:"userName"`
+	RemoteAddr  string `json:"remoteAddr"`
+	ConnectedAt string `json:"connectedAt"`
 }
@@ -0,0 +1,274 @@
+// gRPC API of the ciphertalk server. Messages mirror the JSON models in common/models,
+// regenerate the Go code with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative common/pb/ciphertalk.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: common/pb/ciphertalk.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Ciphertalk_Register_FullMethodName     = "/ciphertalk.v1.Ciphertalk/Register"
+	Ciphertalk_Login_FullMethodName        = "/ciphertalk.v1.Ciphertalk/Login"
+	Ciphertalk_GetPublicKey_FullMethodName = "/ciphertalk.v1.Ciphertalk/GetPublicKey"
+	Ciphertalk_Chat_FullMethodName         = "/ciphertalk.v1.Ciphertalk/Chat"
+)
+
+// CiphertalkClient is the client API for Ciphertalk service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Ciphertalk exposes login, the key directory and message routing to backend services
+type CiphertalkClient interface {
+	// Register creates an account
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// Login verifies the password, stores the public key and issues an auth token
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	// GetPublicKey returns the public key of a registered user, requires the directory:read scope
+	GetPublicKey(ctx context.Context, in *ChannelRequest, opts ...grpc.CallOption) (*ChannelResponse, error)
+	// Chat sends messages from the caller and delivers messages addressed to it, requires the chat:send scope
+	Chat(ctx context.Context, opts ...grpc.CallOption) (Ciphertalk_ChatClient, error)
+}
+
+type ciphertalkClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCiphertalkClient(cc grpc.ClientConnInterface) CiphertalkClient {
+	return &ciphertalkClient{cc}
+}
+
+func (c *ciphertalkClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, Ciphertalk_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ciphertalkClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, Ciphertalk_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ciphertalkClient) GetPublicKey(ctx context.Context, in *ChannelRequest, opts ...grpc.CallOption) (*ChannelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChannelResponse)
+	err := c.cc.Invoke(ctx, Ciphertalk_GetPublicKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ciphertalkClient) Chat(ctx context.Context, opts ...grpc.CallOption) (Ciphertalk_ChatClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ciphertalk_ServiceDesc.Streams[0], Ciphertalk_Chat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ciphertalkChatClient{ClientStream: stream}
+	return x, nil
+}
+
+type Ciphertalk_ChatClient interface {
+	Send(*Message) error
+	Recv() (*ChatFrame, error)
+	grpc.ClientStream
+}
+
+type ciphertalkChatClient struct {
+	grpc.ClientStream
+}
+
+func (x *ciphertalkChatClient) Send(m *Message) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ciphertalkChatClient) Recv() (*ChatFrame, error) {
+	m := new(ChatFrame)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CiphertalkServer is the server API for Ciphertalk service.
+// All implementations must embed UnimplementedCiphertalkServer
+// for forward compatibility
+//
+// Ciphertalk exposes login, the key directory and message routing to backend services
+type CiphertalkServer interface {
+	// Register creates an account
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// Login verifies the password, stores the public key and issues an auth token
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// GetPublicKey returns the public key of a registered user, requires the directory:read scope
+	GetPublicKey(context.Context, *ChannelRequest) (*ChannelResponse, error)
+	// Chat sends messages from the caller and delivers messages addressed to it, requires the chat:send scope
+	Chat(Ciphertalk_ChatServer) error
+	mustEmbedUnimplementedCiphertalkServer()
+}
+
+// UnimplementedCiphertalkServer must be embedded to have forward compatible implementations.
+type UnimplementedCiphertalkServer struct {
+}
+
+func (UnimplementedCiphertalkServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedCiphertalkServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedCiphertalkServer) GetPublicKey(context.Context, *ChannelRequest) (*ChannelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPublicKey not implemented")
+}
+func (UnimplementedCiphertalkServer) Chat(Ciphertalk_ChatServer) error {
+	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedCiphertalkServer) mustEmbedUnimplementedCiphertalkServer() {}
+
+// UnsafeCiphertalkServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CiphertalkServer will
+// result in compilation errors.
+type UnsafeCiphertalkServer interface {
+	mustEmbedUnimplementedCiphertalkServer()
+}
+
+func RegisterCiphertalkServer(s grpc.ServiceRegistrar, srv CiphertalkServer) {
+	s.RegisterService(&Ciphertalk_ServiceDesc, srv)
+}
+
+func _Ciphertalk_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CiphertalkServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ciphertalk_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CiphertalkServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ciphertalk_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CiphertalkServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ciphertalk_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CiphertalkServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ciphertalk_GetPublicKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CiphertalkServer).GetPublicKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ciphertalk_GetPublicKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CiphertalkServer).GetPublicKey(ctx, req.(*ChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ciphertalk_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CiphertalkServer).Chat(&ciphertalkChatServer{ServerStream: stream})
+}
+
+type Ciphertalk_ChatServer interface {
+	Send(*ChatFrame) error
+	Recv() (*Message, error)
+	grpc.ServerStream
+}
+
+type ciphertalkChatServer struct {
+	grpc.ServerStream
+}
+
+func (x *ciphertalkChatServer) Send(m *ChatFrame) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ciphertalkChatServer) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Ciphertalk_ServiceDesc is the grpc.ServiceDesc for Ciphertalk service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ciphertalk_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ciphertalk.v1.Ciphertalk",
+	HandlerType: (*CiphertalkServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Ciphertalk_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _Ciphertalk_Login_Handler,
+		},
+		{
+			MethodName: "GetPublicKey",
+			Handler:    _Ciphertalk_GetPublicKey_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       _Ciphertalk_Chat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "common/pb/ciphertalk.proto",
+}
@@ -0,0 +1,222 @@
+package e2e
+
+import (
+	"bytes"
+	"ciphertalk/common/codec"
+	"ciphertalk/common/models"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogin_KeyLookup(t *testing.T) {
+	// arrange
+	h := newHarness(t)
+	alice, bob := h.newClient("alice"), h.newClient("bob")
+
+	// act
+	key, err := alice.lookupKey(bob.name)
+	_, unknownErr := alice.lookupKey("nobody-" + bob.name)
+
+	// assert
+	if err != nil {
+		t.Fatal("Unable to look up key:", err)
+	}
+	if *key != *bob.publicKey {
+		t.Error("Looked up key does not match the key bob logged in with")
+	}
+	if unknownErr == nil || !strings.Contains(unknownErr.Error(), fmt.Sprint(http.StatusNotFound)) {
+		t.Error("Expected unknown user to be not found, got:", unknownErr)
+	}
+}
+
+func TestSendReceive_Encrypted(t *testing.T) {
+	var codecs = []struct {
+		name          string
+		sender, reply codec.Codec
+	}{
+		{"json", codec.JSON, codec.JSON},
+		{"cbor", codec.CBOR, codec.CBOR},
+		{"cbor to json", codec.CBOR, codec.JSON},
+	}
+
+	for _, entry := range codecs {
+		t.Run(entry.name, func(t *testing.T) {
+			// arrange
+			h := newHarness(t)
+			alice, bob := h.newClient("alice"), h.newClient("bob")
+			if err := alice.connectWith(entry.sender); err != nil {
+				t.Fatal("Unable to connect:", err)
+			}
+			defer alice.disconnect()
+			if err := bob.connectWith(entry.reply); err != nil {
+				t.Fatal("Unable to connect:", err)
+			}
+			defer bob.disconnect()
+			h.waitSessions(bob.name, 1)
+
+			msg, err := alice.seal(bob.name, models.Payload{Text: "attack at dawn"})
+			if err != nil {
+				t.Fatal("Unable to seal message:", err)
+			}
+
+			// act
+			err = alice.write(msg)
+			frame, receiveErr := bob.receive()
+
+			// assert
+			if err != nil || receiveErr != nil {
+				t.Fatal("Unable to exchange message:", err, receiveErr)
+			}
+			if frame.err != nil {
+				t.Fatal("Unexpected error frame:", frame.err.Error)
+			}
+			if frame.payload.Text != "attack at dawn" {
+				t.Errorf("Unexpected text %[1]q", frame.payload.Text)
+			}
+			if bytes.Contains(frame.msg.Body, []byte("attack at dawn")) {
+				t.Error("Expected body on the wire to be encrypted")
+			}
+			if frame.msg.ID != msg.ID || frame.msg.MsgNonce != msg.MsgNonce {
+				t.Error("Expected envelope to be relayed unchanged")
+			}
+		})
+	}
+}
+
+func TestSend_Rejected(t *testing.T) {
+	// arrange
+	h := newHarness(t)
+	alice, bob := h.newClient("alice"), h.newClient("bob")
+	if err := alice.connect(); err != nil {
+		t.Fatal("Unable to connect:", err)
+	}
+	defer alice.disconnect()
+
+	forged, _ := alice.seal(bob.name, models.Payload{Text: "forged"})
+	forged.SenderID = bob.name
+	unknown, _ := alice.seal(bob.name, models.Payload{Text: "lost"})
+	unknown.RecipientID = "nobody-" + bob.name
+
+	var rejected = []struct {
+		msg  models.Message
+		code int
+	}{
+		{forged, http.StatusForbidden},
+		{unknown, http.StatusNotFound},
+	}
+
+	for _, entry := range rejected {
+		// act
+		err := alice.write(entry.msg)
+		frame, receiveErr := alice.receive()
+
+		// assert
+		if err != nil || receiveErr != nil {
+			t.Fatal("Unable to exchange message:", err, receiveErr)
+		}
+		if frame.err == nil || frame.err.Code != entry.code {
+			t.Errorf("Expected error frame with code %[1]d, got %+[2]v", entry.code, frame.err)
+		}
+	}
+}
+
+func TestDisconnect_QueuedUntilReconnect(t *testing.T) {
+	// arrange
+	h := newHarness(t)
+	alice, bob := h.newClient("alice"), h.newClient("bob")
+	if err := alice.connect(); err != nil {
+		t.Fatal("Unable to connect:", err)
+	}
+	defer alice.disconnect()
+	if err := bob.connect(); err != nil {
+		t.Fatal("Unable to connect:", err)
+	}
+	h.waitSessions(bob.name, 1)
+	bob.disconnect()
+	h.waitSessions(bob.name, 0)
+
+	for i := 0; i < 3; i++ {
+		if err := alice.sendText(bob.name, fmt.Sprint("while offline ", i)); err != nil {
+			t.Fatal("Unable to send:", err)
+		}
+	}
+
+	// act
+	err := bob.connect()
+
+	// assert
+	if err != nil {
+		t.Fatal("Unable to reconnect:", err)
+	}
+	defer bob.disconnect()
+	for i := 0; i < 3; i++ {
+		text, err := bob.receiveText(alice.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := fmt.Sprint("while offline ", i); text != expected {
+			t.Errorf("Expected %[1]q, got %[2]q", expected, text)
+		}
+	}
+}
+
+func TestConcurrentUsers(t *testing.T) {
+	// arrange
+	const users, messages = 16, 10
+	h := newHarness(t)
+
+	clients := make([]*client, users)
+	for i := range clients {
+		clients[i] = h.newClient("ring")
+		if err := clients[i].connect(); err != nil {
+			t.Fatal("Unable to connect:", err)
+		}
+		defer clients[i].disconnect()
+	}
+	for _, c := range clients {
+		h.waitSessions(c.name, 1)
+	}
+
+	// act
+	// every user sends to the next one in a ring and receives from the previous one at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*users)
+	for i, c := range clients {
+		next, previous := clients[(i+1)%users], clients[(i+users-1)%users]
+
+		wg.Add(2)
+		go func(c *client, next *client) {
+			defer wg.Done()
+			for m := 0; m < messages; m++ {
+				if err := c.sendText(next.name, fmt.Sprintf("%[1]s #%[2]d", c.name, m)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(c, next)
+		go func(c *client, previous *client) {
+			defer wg.Done()
+			for m := 0; m < messages; m++ {
+				text, err := c.receiveText(previous.name)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if expected := fmt.Sprintf("%[1]s #%[2]d", previous.name, m); text != expected {
+					errs <- fmt.Errorf("%[1]s: expected %[2]q, got %[3]q", c.name, expected, text)
+					return
+				}
+			}
+		}(c, previous)
+	}
+	wg.Wait()
+	close(errs)
+
+	// assert
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,349 @@
+package e2e
+
+import (
+	"bytes"
+	"ciphertalk/common/codec"
+	"ciphertalk/common/constants"
+	"ciphertalk/common/envelope"
+	"ciphertalk/common/models"
+	"ciphertalk/server"
+	"ciphertalk/server/auth"
+	"ciphertalk/server/controller"
+	"ciphertalk/server/ratelimit"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// how long a client waits for a frame before the test fails
+const receiveTimeout = 5 * time.Second
+
+// adminToken lets the harness watch connected sessions through the admin API
+const adminToken = "e2e-admin-token"
+
+// testConfig mirrors the server defaults with limits high enough for concurrent tests
+var testConfig = server.Config{
+	RateLimits: server.RateLimits{
+		Login:     ratelimit.Config{Rate: 100, Burst: 100},
+		Secure:    ratelimit.Config{Rate: 1000, Burst: 1000},
+		Websocket: ratelimit.Config{Rate: 100, Burst: 100},
+		Messages:  ratelimit.Config{Rate: 1000, Burst: 1000},
+		Signals:   ratelimit.Config{Rate: 100, Burst: 100},
+	},
+	Validation: controller.Validation{
+		MaxFrameSize: 64 * 1024,
+		MaxBodySize:  32 * 1024,
+		MaxClockSkew: 5 * time.Minute,
+	},
+	QueueSize:      100,
+	QueueRetention: time.Hour,
+	AdminToken:     adminToken,
+}
+
+// user names are unique per process because accounts and keys are kept in package state of the server
+var userCounter int64
+
+func TestMain(m *testing.M) {
+	auth.PasswordCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+// harness runs the whole HTTP API in-process
+type harness struct {
+	t      *testing.T
+	server *httptest.Server
+}
+
+func newHarness(t *testing.T) *harness {
+	handler, ctrl := server.NewHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), testConfig)
+	srv := httptest.NewServer(handler)
+	// cleanups run last in first out, so the controller stops after the server closed its connections
+	t.Cleanup(ctrl.Close)
+	t.Cleanup(srv.Close)
+
+	return &harness{t: t, server: srv}
+}
+
+// sessions returns the number of websocket sessions of user
+func (h *harness) sessions(user string) int {
+	h.t.Helper()
+	req, _ := http.NewRequest("GET", h.server.URL+"/admin/sessions", nil)
+	req.Header.Set(constants.HTTPAuthorization, "Bearer "+adminToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatal("Unable to list sessions:", err)
+	}
+	defer resp.Body.Close()
+
+	var sessions []models.SessionSummary
+	json.NewDecoder(resp.Body).Decode(&sessions)
+
+	count := 0
+	for _, session := range sessions {
+		if session.UserName == user {
+			count++
+		}
+	}
+	return count
+}
+
+// waitSessions waits until user has the expected number of websocket sessions
+func (h *harness) waitSessions(user string, expected int) {
+	h.t.Helper()
+	deadline := time.Now().Add(receiveTimeout)
+	for h.sessions(user) != expected {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("Expected %[1]s to have %[2]d sessions", user, expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newClient registers and logs in a user whose name starts with prefix
+func (h *harness) newClient(prefix string) *client {
+	h.t.Helper()
+	c := &client{
+		h:    h,
+		name: fmt.Sprintf("%[1]s-%[2]d", prefix, atomic.AddInt64(&userCounter, 1)),
+		keys: map[string]*[32]byte{},
+	}
+
+	var err error
+	if c.publicKey, c.privateKey, err = box.GenerateKey(rand.Reader); err != nil {
+		h.t.Fatal("Unable to generate keys:", err)
+	}
+
+	password := c.name + "-password"
+	if status, err := c.post("/register", models.RegisterRequest{UserName: c.name, Password: password}, nil); status != http.StatusCreated {
+		h.t.Fatalf("Unable to register %[1]s: %[2]d %[3]v", c.name, status, err)
+	}
+
+	var login models.LoginResponse
+	if status, err := c.post("/login", models.LoginRequest{UserName: c.name, Password: password, PublicKey: *c.publicKey}, &login); status != http.StatusOK {
+		h.t.Fatalf("Unable to login %[1]s: %[2]d %[3]v", c.name, status, err)
+	}
+	c.token = login.AuthToken
+
+	return c
+}
+
+// received is a decrypted message or an error frame sent by the server
+type received struct {
+	msg     models.Message
+	payload models.Payload
+	err     *models.ErrorFrame
+}
+
+// client talks to the server like the Go client: it encrypts payloads with nacl box for the recipient's key
+// looked up on /secure and exchanges envelopes over a websocket
+type client struct {
+	h                     *harness
+	name                  string
+	token                 string
+	publicKey, privateKey *[32]byte
+
+	keysMutex sync.Mutex
+	keys      map[string]*[32]byte
+
+	conn       *websocket.Conn
+	codec      codec.Codec
+	writeMutex sync.Mutex
+	frames     chan received
+}
+
+func (c *client) post(path string, body interface{}, v interface{}) (int, error) {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest(constants.HTTPPost, c.h.server.URL+path, bytes.NewReader(payload))
+	req.Header.Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+	if c.token != "" {
+		req.Header.Set(constants.HTTPAuthorization, "Bearer "+c.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, errors.New(strings.TrimSpace(string(message)))
+	}
+
+	if v != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode, nil
+}
+
+// lookupKey returns the public key of user from /secure, keys are cached like in the Go client
+func (c *client) lookupKey(user string) (*[32]byte, error) {
+	c.keysMutex.Lock()
+	defer c.keysMutex.Unlock()
+
+	if key, ok := c.keys[user]; ok {
+		return key, nil
+	}
+
+	var res models.ChannelResponse
+	if status, err := c.post("/secure", models.ChannelRequest{UserName: user}, &res); err != nil {
+		return nil, fmt.Errorf("key lookup of %[1]s failed: %[2]d %[3]v", user, status, err)
+	}
+
+	key := [32]byte(res.PublicKey)
+	c.keys[user] = &key
+	return &key, nil
+}
+
+// connect opens a websocket with the JSON codec
+func (c *client) connect() error {
+	return c.connectWith(codec.JSON)
+}
+
+// connectWith opens a websocket which negotiates the subprotocol of frameCodec
+func (c *client) connectWith(frameCodec codec.Codec) error {
+	dialer := websocket.Dialer{}
+	if frameCodec == codec.CBOR {
+		dialer.Subprotocols = []string{constants.WebsocketProtocolCBOR}
+	}
+
+	headers := http.Header{constants.HTTPAuthorization: {"Bearer " + c.token}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(c.h.server.URL, "http")+"/websockets", headers)
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.codec = codec.ForProtocol(conn.Subprotocol())
+	c.frames = make(chan received, 1024)
+	go c.read(conn, c.frames)
+	return nil
+}
+
+// read decodes and decrypts frames until the connection closes
+func (c *client) read(conn *websocket.Conn, frames chan<- received) {
+	defer close(frames)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var errFrame models.ErrorFrame
+		if c.codec.Unmarshal(data, &errFrame) == nil && errFrame.Error != "" {
+			frames <- received{err: &errFrame}
+			continue
+		}
+
+		var msg models.Message
+		if err = c.codec.Unmarshal(data, &msg); err != nil {
+			frames <- received{err: &models.ErrorFrame{Error: "undecodable frame: " + err.Error()}}
+			continue
+		}
+
+		senderKey, err := c.lookupKey(msg.SenderID)
+		if err != nil {
+			frames <- received{msg: msg, err: &models.ErrorFrame{Error: err.Error()}}
+			continue
+		}
+
+		payload, err := envelope.Open(msg, senderKey, c.privateKey)
+		if err != nil {
+			frames <- received{msg: msg, err: &models.ErrorFrame{Error: "unable to decrypt message from " + msg.SenderID}}
+			continue
+		}
+
+		frames <- received{msg: msg, payload: payload}
+	}
+}
+
+// disconnect closes the websocket
+func (c *client) disconnect() {
+	c.conn.Close()
+	for range c.frames {
+	}
+}
+
+// seal encrypts payload for the recipient with the Go client's envelope package
+func (c *client) seal(to string, payload models.Payload) (models.Message, error) {
+	key, err := c.lookupKey(to)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return envelope.Seal(payload, c.name, to, key, c.privateKey, time.Now())
+}
+
+// sendText encrypts text for the recipient and sends it over the websocket
+func (c *client) sendText(to string, text string) error {
+	msg, err := c.seal(to, models.Payload{Text: text})
+	if err != nil {
+		return err
+	}
+	return c.write(msg)
+}
+
+// write sends an envelope as it is
+func (c *client) write(msg models.Message) error {
+	data, err := c.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	frameType := websocket.TextMessage
+	if c.codec.Binary() {
+		frameType = websocket.BinaryMessage
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteMessage(frameType, data)
+}
+
+// receive waits for the next frame
+func (c *client) receive() (received, error) {
+	select {
+	case frame, ok := <-c.frames:
+		if !ok {
+			return received{}, errors.New(c.name + ": connection closed")
+		}
+		return frame, nil
+	case <-time.After(receiveTimeout):
+		return received{}, errors.New(c.name + ": timed out waiting for a frame")
+	}
+}
+
+// receiveText waits for the next message and fails unless it is decrypted text from sender
+func (c *client) receiveText(sender string) (string, error) {
+	frame, err := c.receive()
+	if err != nil {
+		return "", err
+	}
+
+	if frame.err != nil {
+		return "", fmt.Errorf("%[1]s: expected message from %[2]s, got error %[3]s (%[4]d)", c.name, sender, frame.err.Error, frame.err.Code)
+	}
+
+	if frame.msg.SenderID != sender {
+		return "", fmt.Errorf("%[1]s: expected message from %[2]s, got one from %[3]s", c.name, sender, frame.msg.SenderID)
+	}
+
+	return frame.payload.Text, nil
+}
@@ -1,7 +1,101 @@
 package main
 
-import "ciphertalk/server"
+import (
+	"ciphertalk/server"
+	"ciphertalk/server/controller"
+	"ciphertalk/server/logging"
+	"ciphertalk/server/origin"
+	"ciphertalk/server/ratelimit"
+	"flag"
+	"os"
+	"time"
+)
+
+var port = flag.String("port", "3000", "port to listen on")
+var grpcPort = flag.String("grpc-port", "", "port to serve the gRPC API on, the API is disabled when empty")
+var logLevel = flag.String("log-level", "info", "log level: debug, info, warn or error")
+var logJSON = flag.Bool("log-json", false, "write logs as JSON")
+var hashUserIDs = flag.Bool("log-hash-users", false, "replace user ids in logs with a keyed hash")
+var hashKey = flag.String("log-hash-key", "", "key for hashed user ids so they stay stable across restarts, defaults to $CIPHERTALK_LOG_HASH_KEY, random when empty")
+var maxFrameSize = flag.Int64("max-frame-size", 64*1024, "largest websocket frame in bytes accepted from a client, 0 for no limit")
+var maxBodySize = flag.Int("max-body-size", 32*1024, "largest encrypted message body in bytes, 0 for no limit")
+var maxBlobSize = flag.Int64("max-blob-size", 1024*1024, "largest encrypted file chunk in bytes accepted on upload")
+var blobCapacity = flag.Int64("blob-capacity", 256*1024*1024, "total size in bytes of encrypted file chunks kept in memory")
+var blobQuota = flag.Int64("blob-quota", 32*1024*1024, "total size in bytes of encrypted file chunks kept for one user, 0 for no limit")
+var blobRetention = flag.Duration("blob-retention", 24*time.Hour, "how long encrypted file chunks are kept after their upload, 0 to keep them")
+var queueSize = flag.Int("queue-size", 100, "number of messages kept per offline recipient, 0 for no limit")
+var queueRetention = flag.Duration("queue-retention", 24*time.Hour, "how long messages are kept for offline recipients")
+var keyRotation = flag.Duration("key-rotation", 24*time.Hour, "how often the token signing key is rotated, 0 to disable")
+var tlsCert = flag.String("tls-cert", "", "PEM certificate chain, enables HTTPS and wss together with --tls-key")
+var tlsKey = flag.String("tls-key", "", "PEM private key for --tls-cert")
+var tlsSelfSigned = flag.Bool("tls-self-signed", false, "serve TLS with a generated certificate for localhost, for development only")
+var tlsClientCA = flag.String("tls-client-ca", "", "PEM bundle of CAs, clients must present a certificate signed by one of them")
+var adminToken = flag.String("admin-token", "", "bearer token for the admin API, defaults to $CIPHERTALK_ADMIN_TOKEN, the API is disabled when empty")
+var maxClockSkew = flag.Duration("max-clock-skew", 5*time.Minute, "allowed difference between message timestamp and server time, 0 to disable")
+
+var allowedOrigins origin.AllowList
+
+var limits = server.RateLimits{
+	Login:     ratelimit.Config{Rate: 0.2, Burst: 5},
+	Secure:    ratelimit.Config{Rate: 2, Burst: 20},
+	Websocket: ratelimit.Config{Rate: 0.5, Burst: 10},
+	Messages:  ratelimit.Config{Rate: 10, Burst: 20},
+	Signals:   ratelimit.Config{Rate: 2, Burst: 5},
+	Blobs:     ratelimit.Config{Rate: 20, Burst: 100},
+}
+
+func init() {
+	flag.Var(&allowedOrigins, "allowed-origins", "comma separated browser origins allowed to call the API from other sites, * for any")
+	flag.Var(&limits.Login, "limit-login", "/login rate limit per IP and user as <rate per second>,<burst>")
+	flag.Var(&limits.Secure, "limit-secure", "/secure rate limit per IP and user as <rate per second>,<burst>")
+	flag.Var(&limits.Websocket, "limit-websocket", "websocket connection rate limit per IP as <rate per second>,<burst>")
+	flag.Var(&limits.Messages, "limit-messages", "message rate limit per connection as <rate per second>,<burst>")
+	flag.Var(&limits.Signals, "limit-signals", "typing indicator rate limit per connection as <rate per second>,<burst>")
+	flag.Var(&limits.Blobs, "limit-blobs", "/blobs rate limit per IP and user as <rate per second>,<burst>")
+}
 
 func main() {
-	server.Initialize()
+	flag.Parse()
+
+	// read after parsing so the key is not printed as the flag's default by -h
+	if *hashKey == "" {
+		*hashKey = os.Getenv("CIPHERTALK_LOG_HASH_KEY")
+	}
+
+	// the environment keeps the token out of the process list
+	if *adminToken == "" {
+		*adminToken = os.Getenv("CIPHERTALK_ADMIN_TOKEN")
+	}
+
+	server.Initialize(server.Config{
+		Port: *port,
+		Logging: logging.Config{
+			Level:       *logLevel,
+			JSON:        *logJSON,
+			HashUserIDs: *hashUserIDs,
+			HashKey:     []byte(*hashKey),
+		},
+		RateLimits: limits,
+		Validation: controller.Validation{
+			MaxFrameSize: *maxFrameSize,
+			MaxBodySize:  *maxBodySize,
+			MaxClockSkew: *maxClockSkew,
+		},
+		MaxBlobSize:    *maxBlobSize,
+		BlobCapacity:   *blobCapacity,
+		BlobQuota:      *blobQuota,
+		BlobRetention:  *blobRetention,
+		QueueSize:      *queueSize,
+		QueueRetention: *queueRetention,
+		AllowedOrigins: allowedOrigins,
+		KeyRotation:    *keyRotation,
+		TLS: server.TLSConfig{
+			CertFile:     *tlsCert,
+			KeyFile:      *tlsKey,
+			SelfSigned:   *tlsSelfSigned,
+			ClientCAFile: *tlsClientCA,
+		},
+		AdminToken: *adminToken,
+		GRPCPort:   *grpcPort,
+	})
 }
@@ -0,0 +1,51 @@
+// Package apidoc serves the OpenAPI description of the HTTP API, the AsyncAPI description of websocket frames
+// and HTML docs generated from them. Tests validate real responses against the documents with Validate.
+package apidoc
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"net/http"
+
+	"ciphertalk/common/constants"
+)
+
+//go:embed openapi.json asyncapi.json
+var files embed.FS
+
+// document names, schema references start with one of them
+const (
+	OpenAPI  = "openapi.json"
+	AsyncAPI = "asyncapi.json"
+)
+
+var documents = map[string]map[string]interface{}{}
+
+func init() {
+	for _, name := range []string{OpenAPI, AsyncAPI} {
+		data, _ := files.ReadFile(name)
+		var doc map[string]interface{}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			panic("apidoc: invalid " + name + ": " + err.Error())
+		}
+		documents[name] = doc
+	}
+}
+
+// Handler serves an embedded document such as OpenAPI
+func Handler(name string) http.Handler {
+	data, err := files.ReadFile(name)
+	if err != nil {
+		panic("apidoc: unknown document " + name)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Write(data)
+	})
+}
@@ -0,0 +1,171 @@
+package apidoc
+
+import (
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// schemas which describe a model, every JSON field of the model has to be documented and nothing else
+var modelSchemas = []struct {
+	schema string
+	model  interface{}
+}{
+	{"RegisterRequest", models.RegisterRequest{}},
+	{"LoginRequest", models.LoginRequest{}},
+	{"LoginResponse", models.LoginResponse{}},
+	{"ChannelRequest", models.ChannelRequest{}},
+	{"ChannelResponse", models.ChannelResponse{}},
+	{"Message", models.Message{}},
+	{"ErrorFrame", models.ErrorFrame{}},
+	{"TokenRequest", models.TokenRequest{}},
+	{"DeliveryCertificateResponse", models.DeliveryCertificateResponse{}},
+	{"WebsocketTicketResponse", models.WebsocketTicketResponse{}},
+	{"UserSummary", models.UserSummary{}},
+	{"SessionSummary", models.SessionSummary{}},
+	{"JSONWebKeySet/properties/keys/items", auth.JSONWebKey{}},
+}
+
+func TestSchemas_MatchModels(t *testing.T) {
+	for _, entry := range modelSchemas {
+		// arrange
+		_, schema, err := resolve(OpenAPI, "#/components/schemas/"+entry.schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		// act
+		fields := jsonFields(reflect.TypeOf(entry.model))
+
+		// assert
+		if documented := sortedKeys(properties); !reflect.DeepEqual(documented, sortedNames(fields)) {
+			t.Errorf("Schema %v documents %v, model has %v", entry.schema, documented, sortedNames(fields))
+		}
+
+		for name, fieldType := range fields {
+			property, _ := properties[name].(map[string]interface{})
+			for _, fixed := range []reflect.Type{reflect.TypeOf(models.Key32{}), reflect.TypeOf(models.Nonce24{})} {
+				if fieldType == fixed && property["$ref"] != "#/components/schemas/"+fixed.Name() {
+					t.Errorf("Property %v of %v should refer to %v", name, entry.schema, fixed.Name())
+				}
+			}
+		}
+	}
+}
+
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+func sortedNames(fields map[string]reflect.Type) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestReferences_Resolve(t *testing.T) {
+	for name, doc := range documents {
+		walk(doc, func(ref string) {
+			if _, _, err := resolve(name, ref); err != nil {
+				t.Errorf("%v: %v", name, err)
+			}
+		})
+	}
+}
+
+func walk(node interface{}, visit func(ref string)) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := node["$ref"].(string); ok {
+			visit(ref)
+		}
+		for _, child := range node {
+			walk(child, visit)
+		}
+	case []interface{}:
+		for _, child := range node {
+			walk(child, visit)
+		}
+	}
+}
+
+var validateMessageTable = []struct {
+	json  string
+	valid bool
+}{
+	{`{"senderId":"foo","recepientId":"bar","body":"c2VjcmV0","timeStamp":"","msgNonce":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}`, true},
+	{`{"senderId":"foo","recepientId":"bar","body":"c2VjcmV0","timeStamp":"","msgNonce":"AAAA"}`, false},
+	{`{"senderId":"foo","recepientId":"bar","body":"c2VjcmV0","timeStamp":""}`, false},
+	{`{"senderId":"foo","recepientId":"bar","body":"not base64!","timeStamp":"","msgNonce":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}`, false},
+	{`{"senderId":"foo","recepientId":"bar","body":"","timeStamp":"","msgNonce":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA","ttl":1.5}`, false},
+	{`{"senderId":"foo","recepientId":"bar","body":"","timeStamp":"","msgNonce":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA","extra":1}`, false},
+	{`[]`, false},
+}
+
+func TestValidate(t *testing.T) {
+	for _, entry := range validateMessageTable {
+		// act
+		err := Validate(OpenAPI+"#/components/schemas/Message", []byte(entry.json))
+
+		// assert
+		if (err == nil) != entry.valid {
+			t.Errorf("Unexpected result for %v. expected valid: %v, actual error: %v", entry.json, entry.valid, err)
+		}
+	}
+}
+
+func TestValidateResponse_Undocumented(t *testing.T) {
+	// act
+	err := ValidateResponse("POST", "/login", http.StatusTeapot, "text/plain", []byte("teapot"))
+
+	// assert
+	if err == nil {
+		t.Error("Expected undocumented status to be rejected")
+	}
+}
+
+func TestValidateFrame(t *testing.T) {
+	// arrange
+	errorFrame := []byte(`{"error":"Too many messages","code":429}`)
+
+	// act
+	subscribeErr := ValidateFrame("/websockets", "subscribe", errorFrame)
+	publishErr := ValidateFrame("/websockets", "publish", errorFrame)
+
+	// assert
+	if subscribeErr != nil {
+		t.Error("Expected error frame to be sent by server:", subscribeErr)
+	}
+	if publishErr == nil {
+		t.Error("Expected error frame to be rejected from clients")
+	}
+}
+
+func TestDocsHandler(t *testing.T) {
+	// arrange
+	wr := httptest.NewRecorder()
+	// act
+	DocsHandler().ServeHTTP(wr, httptest.NewRequest("GET", "/docs", nil))
+	// assert
+	for _, expected := range []string{"<code>/login</code>", `id="LoginRequest"`, "Key32"} {
+		if !strings.Contains(wr.Body.String(), expected) {
+			t.Errorf("Expected docs to contain %v", expected)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package apidoc
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// order in which operations of a path are listed
+var methods = []string{"get", "put", "post", "delete"}
+
+type operation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Statuses    []string
+}
+
+type property struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+}
+
+type schema struct {
+	Name        string
+	Description string
+	Properties  []property
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} API</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; }
+code, .method { font-family: monospace; }
+table { border-collapse: collapse; width: 100%; }
+td, th { border-bottom: 1px solid #ddd; padding: .3em; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} API {{.Version}}</h1>
+<p>{{.Description}}</p>
+<p>Machine-readable: <a href="/openapi.json">openapi.json</a>, websocket frames: <a href="/asyncapi.json">asyncapi.json</a></p>
+<h2>Operations</h2>
+<table>
+<tr><th>Operation</th><th>Description</th><th>Responses</th></tr>
+{{range .Operations}}<tr><td><span class="method">{{.Method}}</span> <code>{{.Path}}</code></td><td>{{.Summary}}{{if .Description}}<br><small>{{.Description}}</small>{{end}}</td><td>{{range .Statuses}}{{.}} {{end}}</td></tr>
+{{end}}</table>
+<h2>Schemas</h2>
+{{range .Schemas}}<h3 id="{{.Name}}">{{.Name}}</h3>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+{{if .Properties}}<table>
+<tr><th>Property</th><th>Type</th><th>Description</th></tr>
+{{range .Properties}}<tr><td><code>{{.Name}}</code>{{if .Required}} *{{end}}</td><td>{{.Type}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// DocsHandler serves HTML docs generated from the OpenAPI document
+func DocsHandler() http.Handler {
+	var page bytes.Buffer
+	if err := docsTemplate.Execute(&page, docsData()); err != nil {
+		panic("apidoc: unable to render docs: " + err.Error())
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page.Bytes())
+	})
+}
+
+func docsData() map[string]interface{} {
+	doc := documents[OpenAPI]
+	info, _ := doc["info"].(map[string]interface{})
+
+	return map[string]interface{}{
+		"Title":       info["title"],
+		"Version":     info["version"],
+		"Description": info["description"],
+		"Operations":  operations(doc),
+		"Schemas":     schemas(doc),
+	}
+}
+
+func operations(doc map[string]interface{}) []operation {
+	paths, _ := doc["paths"].(map[string]interface{})
+	var result []operation
+
+	for _, path := range sortedKeys(paths) {
+		item, _ := paths[path].(map[string]interface{})
+		for _, method := range methods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			responses, _ := op["responses"].(map[string]interface{})
+			summary, _ := op["summary"].(string)
+			description, _ := op["description"].(string)
+			result = append(result, operation{
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				Summary:     summary,
+				Description: description,
+				Statuses:    sortedKeys(responses),
+			})
+		}
+	}
+
+	return result
+}
+
+func schemas(doc map[string]interface{}) []schema {
+	components, _ := doc["components"].(map[string]interface{})
+	all, _ := components["schemas"].(map[string]interface{})
+	var result []schema
+
+	for _, name := range sortedKeys(all) {
+		definition, _ := all[name].(map[string]interface{})
+		description, _ := definition["description"].(string)
+		s := schema{Name: name, Description: description}
+
+		required := map[string]bool{}
+		names, _ := definition["required"].([]interface{})
+		for _, n := range names {
+			required[n.(string)] = true
+		}
+
+		properties, _ := definition["properties"].(map[string]interface{})
+		for _, p := range sortedKeys(properties) {
+			prop, _ := properties[p].(map[string]interface{})
+			description, _ := prop["description"].(string)
+			s.Properties = append(s.Properties, property{Name: p, Type: typeName(prop), Required: required[p], Description: description})
+		}
+
+		result = append(result, s)
+	}
+
+	return result
+}
+
+func typeName(prop map[string]interface{}) string {
+	if ref, ok := prop["$ref"].(string); ok {
+		return ref[strings.LastIndex(ref, "/")+1:]
+	}
+
+	if items, ok := prop["items"].(map[string]interface{}); ok {
+		return typeName(items) + "[]"
+	}
+
+	name, _ := prop["type"].(string)
+	if format, ok := prop["format"].(string); ok {
+		name += " (" + format + ")"
+	}
+	return name
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,305 @@
+package apidoc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validate checks JSON data against the schema at ref, such as "openapi.json#/components/schemas/Message".
+// It supports the subset of JSON Schema used by the documents: $ref, oneOf, type, properties, required,
+// additionalProperties, items, enum, pattern, minLength, maxLength and the byte format.
+func Validate(ref string, data []byte) error {
+	doc, schema, err := resolve(OpenAPI, ref)
+	if err != nil {
+		return err
+	}
+
+	value, err := decode(data)
+	if err != nil {
+		return err
+	}
+
+	return validate(doc, schema, value, "$")
+}
+
+// ValidateResponse checks that status is documented for the operation and body matches the documented schema.
+// path is the templated path of the operation, such as "/blobs/{hash}".
+func ValidateResponse(method string, path string, status int, contentType string, body []byte) error {
+	location := "#/paths/" + escape(path) + "/" + strings.ToLower(method) + "/responses/" + strconv.Itoa(status)
+	doc, response, err := resolve(OpenAPI, location)
+	if err != nil {
+		return fmt.Errorf("%[1]s %[2]s: status %[3]d is not documented", method, path, status)
+	}
+	if doc, response, err = follow(doc, response); err != nil {
+		return err
+	}
+
+	content, _ := response["content"].(map[string]interface{})
+	if len(content) == 0 {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return fmt.Errorf("%[1]s %[2]s: status %[3]d documents no body, got %[4]q", method, path, status, body)
+		}
+		return nil
+	}
+
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%[1]s %[2]s: status %[3]d does not document content type %[4]q", method, path, status, mediaType)
+	}
+
+	schema, _ := media["schema"].(map[string]interface{})
+	if mediaType != "application/json" {
+		return validate(doc, schema, string(body), "$")
+	}
+
+	value, err := decode(body)
+	if err != nil {
+		return err
+	}
+	return validate(doc, schema, value, "$")
+}
+
+// ValidateFrame checks a websocket frame against the messages of an AsyncAPI channel operation,
+// operation is "publish" for frames sent by clients and "subscribe" for frames sent by the server
+func ValidateFrame(channel string, operation string, data []byte) error {
+	doc, message, err := resolve(AsyncAPI, "#/channels/"+escape(channel)+"/"+operation+"/message")
+	if err != nil {
+		return err
+	}
+
+	value, err := decode(data)
+	if err != nil {
+		return err
+	}
+
+	candidates := []interface{}{message}
+	if oneOf, ok := message["oneOf"].([]interface{}); ok {
+		candidates = oneOf
+	}
+
+	var errs []string
+	for _, candidate := range candidates {
+		candidateDoc, m, err := follow(doc, candidate.(map[string]interface{}))
+		if err != nil {
+			return err
+		}
+
+		payload, _ := m["payload"].(map[string]interface{})
+		if err = validate(candidateDoc, payload, value, "$"); err == nil {
+			return nil
+		}
+		errs = append(errs, err.Error())
+	}
+
+	return fmt.Errorf("frame matches no %[1]s message of %[2]s: %[3]s", operation, channel, strings.Join(errs, "; "))
+}
+
+func decode(data []byte) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %[1]v", err)
+	}
+	return value, nil
+}
+
+// escape encodes a path as a JSON pointer token
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// resolve finds the object at ref, relative references are looked up in the document named base
+func resolve(base string, ref string) (string, map[string]interface{}, error) {
+	name, pointer, _ := strings.Cut(ref, "#")
+	if name == "" {
+		name = base
+	}
+
+	var node interface{} = documents[name]
+	if documents[name] == nil {
+		return name, nil, fmt.Errorf("unknown document %[1]s", name)
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return name, nil, fmt.Errorf("unresolved reference %[1]s", ref)
+		}
+		if node, ok = object[token]; !ok {
+			return name, nil, fmt.Errorf("unresolved reference %[1]s", ref)
+		}
+	}
+
+	object, ok := node.(map[string]interface{})
+	if !ok {
+		return name, nil, fmt.Errorf("reference %[1]s is not an object", ref)
+	}
+	return name, object, nil
+}
+
+// follow resolves schema while it is a reference
+func follow(doc string, schema map[string]interface{}) (string, map[string]interface{}, error) {
+	for {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return doc, schema, nil
+		}
+
+		var err error
+		if doc, schema, err = resolve(doc, ref); err != nil {
+			return doc, nil, err
+		}
+	}
+}
+
+func validate(doc string, schema map[string]interface{}, value interface{}, path string) error {
+	doc, schema, err := follow(doc, schema)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, candidate := range oneOf {
+			if validate(doc, candidate.(map[string]interface{}), value, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%[1]s: expected exactly one schema of oneOf to match, %[2]d did", path, matches)
+		}
+		return nil
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || fmt.Sprint(allowed) == fmt.Sprint(value)
+		}
+		if !found {
+			return fmt.Errorf("%[1]s: %[2]v is not one of %[3]v", path, value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		return validateObject(doc, schema, value, path)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%[1]s: expected array, got %[2]T", path, value)
+		}
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		for i, item := range items {
+			if err := validate(doc, itemSchema, item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case "string":
+		return validateString(schema, value, path)
+	case "integer":
+		if number, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%[1]s: expected integer, got %[2]T", path, value)
+		} else if _, err := number.Int64(); err != nil {
+			return fmt.Errorf("%[1]s: expected integer, got %[2]v", path, number)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%[1]s: expected number, got %[2]T", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%[1]s: expected boolean, got %[2]T", path, value)
+		}
+	}
+
+	return nil
+}
+
+func validateObject(doc string, schema map[string]interface{}, value interface{}, path string) error {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%[1]s: expected object, got %[2]T", path, value)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	required, _ := schema["required"].([]interface{})
+	for _, name := range required {
+		if _, ok := object[name.(string)]; !ok {
+			return fmt.Errorf("%[1]s: missing required property %[2]s", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := properties[name].(map[string]interface{})
+		if !ok {
+			if schema["additionalProperties"] == false {
+				return fmt.Errorf("%[1]s: unexpected property %[2]s", path, name)
+			}
+			continue
+		}
+
+		if err := validate(doc, property, object[name], path+"."+name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateString(schema map[string]interface{}, value interface{}, path string) error {
+	text, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("%[1]s: expected string, got %[2]T", path, value)
+	}
+
+	if min, ok := schema["minLength"].(json.Number); ok {
+		if n, _ := min.Int64(); int64(utf8.RuneCountInString(text)) < n {
+			return fmt.Errorf("%[1]s: shorter than %[2]d characters", path, n)
+		}
+	}
+
+	if max, ok := schema["maxLength"].(json.Number); ok {
+		if n, _ := max.Int64(); int64(utf8.RuneCountInString(text)) > n {
+			return fmt.Errorf("%[1]s: longer than %[2]d characters", path, n)
+		}
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		matched, err := regexp.MatchString(pattern, text)
+		if err != nil {
+			return fmt.Errorf("%[1]s: invalid pattern %[2]s", path, pattern)
+		}
+		if !matched {
+			return fmt.Errorf("%[1]s: %[2]q does not match %[3]s", path, text, pattern)
+		}
+	}
+
+	if schema["format"] == "byte" {
+		if _, err := base64.StdEncoding.DecodeString(text); err != nil {
+			return fmt.Errorf("%[1]s: expected base64, %[2]v", path, err)
+		}
+	}
+
+	return nil
+}
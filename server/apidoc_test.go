@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/apidoc"
+	"ciphertalk/server/controller"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const testAdminToken = "test-admin-token"
+
+func newTestServer() *httptest.Server {
+	router := mux.NewRouter()
+	ctrl := controller.NewAPIController(slog.Default(), controller.Config{})
+	registerRoutes(router, ctrl, RateLimits{}, nil)
+	registerAdminRoutes(router, ctrl, testAdminToken)
+	return httptest.NewServer(router)
+}
+
+// call sends a request and checks the response against the OpenAPI document, route is the templated path
+func call(t *testing.T, server *httptest.Server, method string, path string, route string, token string, body []byte) []byte {
+	t.Helper()
+	req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+	if token != "" {
+		req.Header.Set(constants.HTTPAuthorization, "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Request failed:", err)
+	}
+	defer resp.Body.Close()
+	payload, _ := io.ReadAll(resp.Body)
+
+	if err = apidoc.ValidateResponse(method, route, resp.StatusCode, resp.Header.Get(constants.HTTPContentType), payload); err != nil {
+		t.Error(err)
+	}
+	return payload
+}
+
+func marshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+func TestAPI_MatchesOpenAPI(t *testing.T) {
+	// arrange
+	server := newTestServer()
+	defer server.Close()
+	user, password := "openapi-alice", "openapi-password"
+	blob := []byte("encrypted chunk")
+	sum := sha256.Sum256(blob)
+	hash := hex.EncodeToString(sum[:])
+
+	call(t, server, "POST", "/register", "/register", "", marshal(models.RegisterRequest{UserName: user, Password: password}))
+	var login models.LoginResponse
+	json.Unmarshal(call(t, server, "POST", "/login", "/login", "", marshal(models.LoginRequest{UserName: user, Password: password, PublicKey: models.Key32{1}})), &login)
+	if login.AuthToken == "" {
+		t.Fatal("Unable to login")
+	}
+
+	var calls = []struct {
+		method string
+		path   string
+		route  string
+		token  string
+		body   []byte
+	}{
+		{"POST", "/register", "/register", "", marshal(models.RegisterRequest{UserName: user, Password: password})},
+		{"POST", "/register", "/register", "", marshal(models.RegisterRequest{UserName: "x", Password: password})},
+		{"POST", "/login", "/login", "", marshal(models.LoginRequest{UserName: user, Password: "wrong-password"})},
+		{"POST", "/secure", "/secure", login.AuthToken, marshal(models.ChannelRequest{UserName: user})},
+		{"POST", "/secure", "/secure", login.AuthToken, marshal(models.ChannelRequest{UserName: "openapi-nobody"})},
+		{"POST", "/secure", "/secure", "", marshal(models.ChannelRequest{UserName: user})},
+		{"POST", "/ws-ticket", "/ws-ticket", login.AuthToken, nil},
+		{"POST", "/delivery-certificate", "/delivery-certificate", login.AuthToken, nil},
+		{"POST", "/messages", "/messages", login.AuthToken, marshal(models.Message{SenderID: user, RecipientID: user, Body: []byte("secret"), TimeStamp: time.Now().Format(constants.TimeStampFormat)})},
+		{"POST", "/messages", "/messages", login.AuthToken, marshal(models.Message{SenderID: "openapi-mallory", RecipientID: user, Body: []byte("secret")})},
+		{"PUT", "/blobs/" + hash, "/blobs/{hash}", login.AuthToken, blob},
+		{"GET", "/blobs/" + hash, "/blobs/{hash}", login.AuthToken, nil},
+		{"GET", "/blobs/" + strings.Repeat("0", 64), "/blobs/{hash}", login.AuthToken, nil},
+		{"DELETE", "/blobs/" + hash, "/blobs/{hash}", login.AuthToken, nil},
+		{"DELETE", "/blobs/" + hash, "/blobs/{hash}", login.AuthToken, nil},
+		{"GET", "/.well-known/jwks.json", "/.well-known/jwks.json", "", nil},
+		{"GET", "/admin/users", "/admin/users", testAdminToken, nil},
+		{"GET", "/admin/sessions", "/admin/sessions", testAdminToken, nil},
+		{"GET", "/admin/users", "/admin/users", login.AuthToken, nil},
+		{"POST", "/admin/tokens", "/admin/tokens", testAdminToken, marshal(models.TokenRequest{UserName: user, Scopes: []string{"chat:send"}})},
+		{"POST", "/admin/tokens", "/admin/tokens", testAdminToken, marshal(models.TokenRequest{UserName: user, Scopes: []string{"everything"}})},
+		{"PUT", "/admin/users/openapi-bob/ban", "/admin/users/{name}/ban", testAdminToken, nil},
+		{"DELETE", "/admin/users/openapi-bob/ban", "/admin/users/{name}/ban", testAdminToken, nil},
+		{"DELETE", "/admin/users/openapi-bob/key", "/admin/users/{name}/key", testAdminToken, nil},
+		{"POST", "/admin/users/openapi-bob/logout", "/admin/users/{name}/logout", testAdminToken, nil},
+	}
+
+	for _, c := range calls {
+		// act & assert
+		call(t, server, c.method, c.path, c.route, c.token, c.body)
+	}
+}
+
+func TestWebsocketFrames_MatchAsyncAPI(t *testing.T) {
+	// arrange
+	server := newTestServer()
+	defer server.Close()
+	user, password := "asyncapi-alice", "asyncapi-password"
+	call(t, server, "POST", "/register", "/register", "", marshal(models.RegisterRequest{UserName: user, Password: password}))
+	var login models.LoginResponse
+	json.Unmarshal(call(t, server, "POST", "/login", "/login", "", marshal(models.LoginRequest{UserName: user, Password: password, PublicKey: models.Key32{1}})), &login)
+
+	headers := http.Header{constants.HTTPAuthorization: {"Bearer " + login.AuthToken}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/websockets", headers)
+	if err != nil {
+		t.Fatal("Unable to connect:", err)
+	}
+	defer conn.Close()
+
+	sent := [][]byte{
+		marshal(models.Message{SenderID: user, RecipientID: user, Body: []byte("secret"), TimeStamp: time.Now().Format(constants.TimeStampFormat), MsgNonce: models.Nonce24{1}}),
+		marshal(models.Message{SenderID: user, RecipientID: "asyncapi-nobody", Body: []byte("secret"), TimeStamp: time.Now().Format(constants.TimeStampFormat)}),
+	}
+
+	for _, frame := range sent {
+		if err = apidoc.ValidateFrame("/websockets", "publish", frame); err != nil {
+			t.Error("Sent frame does not match:", err)
+		}
+
+		// act
+		conn.WriteMessage(websocket.TextMessage, frame)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, received, err := conn.ReadMessage()
+
+		// assert
+		if err != nil {
+			t.Fatal("Unable to read frame:", err)
+		}
+		if err = apidoc.ValidateFrame("/websockets", "subscribe", received); err != nil {
+			t.Errorf("Received frame %s does not match: %v", received, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidUserName is returned when a user name does not match the allowed format
+var ErrInvalidUserName = errors.New("user name must be 3 to 64 letters, digits or . _ @ - characters")
+
+// ErrWeakPassword is returned when a password is too short or too long
+var ErrWeakPassword = errors.New("password must be 8 to 72 bytes long")
+
+// ErrUserExists is returned when registering a user name which is already taken
+var ErrUserExists = errors.New("user name is already taken")
+
+// ErrInvalidCredentials is returned when a user does not exist or the password does not match
+var ErrInvalidCredentials = errors.New("invalid user name or password")
+
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{3,64}$`)
+
+// passwords longer than this are silently truncated by bcrypt, so they are rejected instead
+const maxPasswordLength = 72
+const minPasswordLength = 8
+
+// PasswordCost is the bcrypt cost used for new accounts, tests lower it to run faster
+var PasswordCost = bcrypt.DefaultCost
+
+// registered accounts. Map of username (string) to bcrypt password hash
+var accounts = make(map[string][]byte)
+var accountsMutex sync.RWMutex
+
+// ValidateUserName returns an error if the user name can not be registered
+func ValidateUserName(userName string) error {
+	if !userNamePattern.MatchString(userName) {
+		return ErrInvalidUserName
+	}
+	return nil
+}
+
+// Register creates an account with a salted bcrypt hash of the password
+func Register(userName string, password string) error {
+	if err := ValidateUserName(userName); err != nil {
+		return err
+	}
+
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return err
+	}
+
+	accountsMutex.Lock()
+	defer accountsMutex.Unlock()
+
+	if _, ok := accounts[userName]; ok {
+		return ErrUserExists
+	}
+
+	accounts[userName] = hash
+	logger.Info("account registered", "user", userName)
+	return nil
+}
+
+// VerifyPassword returns ErrInvalidCredentials unless the account exists and the password matches
+func VerifyPassword(userName string, password string) error {
+	accountsMutex.RLock()
+	hash, ok := accounts[userName]
+	accountsMutex.RUnlock()
+
+	if !ok {
+		// compare against a dummy hash so unknown user names take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("ciphertalk-dummy-password"), bcrypt.DefaultCost)
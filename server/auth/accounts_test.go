@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestRegisterAndVerifyPassword(t *testing.T) {
+	// arrange
+	user := "account@bar.com"
+	// act
+	err := Register(user, "correct horse")
+	// assert
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if VerifyPassword(user, "correct horse") != nil {
+		t.Error("Correct password was rejected")
+	}
+
+	if VerifyPassword(user, "wrong horse") != ErrInvalidCredentials {
+		t.Error("Wrong password was accepted")
+	}
+
+	if Register(user, "another password") != ErrUserExists {
+		t.Error("User name was registered twice")
+	}
+}
+
+var userNameTable = []struct {
+	userName string
+	valid    bool
+}{
+	{"foo", true},
+	{"foo@bar.com", true},
+	{"foo_bar-1.2", true},
+	{"fo", false},
+	{"foo bar", false},
+	{"foo/bar", false},
+	{"", false},
+}
+
+func TestValidateUserName(t *testing.T) {
+	for _, entry := range userNameTable {
+		if err := ValidateUserName(entry.userName); (err == nil) != entry.valid {
+			t.Errorf("Unexpected result for %q: %v", entry.userName, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+)
+
+// ErrBanned is returned when a banned user tries to log in or use a token
+var ErrBanned = errors.New("user is banned")
+
+// ErrRevoked is returned for tokens issued before the user's sessions were revoked
+var ErrRevoked = errors.New("token has been revoked")
+
+// users who are not allowed to log in
+var bannedUsers = make(map[string]bool)
+
+// session generation of every user, tokens carry the generation they were issued in
+// and are rejected once the generation is incremented
+var sessionGenerations = make(map[string]int)
+
+// UserInfo describes a user in the key directory
+type UserInfo struct {
+	UserName    string
+	Fingerprint string
+	Banned      bool
+}
+
+// Fingerprint returns a short hex encoded sha256 of a public key which operators can compare with clients
+func Fingerprint(pubKey models.Key32) string {
+	sum := sha256.Sum256(pubKey[:])
+	return hex.EncodeToString(sum[:16])
+}
+
+// Users returns registered and banned users sorted by user name
+func Users() []UserInfo {
+	registeredClientsMutex.RLock()
+	defer registeredClientsMutex.RUnlock()
+
+	var users []UserInfo
+	for userName, pubKey := range registeredClients {
+		users = append(users, UserInfo{UserName: userName, Fingerprint: Fingerprint(pubKey), Banned: bannedUsers[userName]})
+	}
+
+	for userName := range bannedUsers {
+		if _, ok := registeredClients[userName]; !ok {
+			users = append(users, UserInfo{UserName: userName, Banned: true})
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+	return users
+}
+
+// RevokeSessions invalidates all tokens issued to the user so far
+func RevokeSessions(userName string) {
+	registeredClientsMutex.Lock()
+	sessionGenerations[userName]++
+	registeredClientsMutex.Unlock()
+	logger.Info("sessions revoked", "user", userName)
+}
+
+// RevokeKey removes the user's public key from the directory and revokes its sessions.
+// The user has to log in again with a new key. Returns false if the user has not been registered.
+func RevokeKey(userName string) bool {
+	registeredClientsMutex.Lock()
+	_, ok := registeredClients[userName]
+	delete(registeredClients, userName)
+	sessionGenerations[userName]++
+	registeredClientsMutex.Unlock()
+
+	if ok {
+		logger.Info("key revoked", "user", userName)
+	}
+	return ok
+}
+
+// Ban removes the user from the directory, revokes its sessions and stops it from logging in again
+func Ban(userName string) {
+	registeredClientsMutex.Lock()
+	bannedUsers[userName] = true
+	delete(registeredClients, userName)
+	sessionGenerations[userName]++
+	registeredClientsMutex.Unlock()
+	logger.Info("user banned", "user", userName)
+}
+
+// Unban allows the user to log in again
+func Unban(userName string) {
+	registeredClientsMutex.Lock()
+	delete(bannedUsers, userName)
+	registeredClientsMutex.Unlock()
+	logger.Info("user unbanned", "user", userName)
+}
+
+// IsBanned returns true if the user is not allowed to log in
+func IsBanned(userName string) bool {
+	registeredClientsMutex.RLock()
+	defer registeredClientsMutex.RUnlock()
+
+	return bannedUsers[userName]
+}
+
+func sessionGeneration(userName string) int {
+	registeredClientsMutex.RLock()
+	defer registeredClientsMutex.RUnlock()
+
+	return sessionGenerations[userName]
+}
+
+// Middleware validates the JWT and rejects tokens of banned users and revoked sessions
+func Middleware(next http.Handler) http.Handler {
+	return JwtMiddleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ParseToken(r.Header.Get(constants.HTTPAuthorization)); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// AdminMiddleware allows requests which carry the admin token as a bearer token or a JWT with the admin scope
+func AdminMiddleware(adminToken string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get(constants.HTTPAuthorization)
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+
+		if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := ParseToken(authHeader)
+		if err != nil {
+			logger.Warn("admin request rejected", "path", r.URL.Path)
+			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		if !user.HasScope(ScopeAdmin) {
+			logger.Warn("missing scope", "user", user.UserName, "scope", ScopeAdmin, "path", r.URL.Path)
+			http.Error(w, "Forbidden. Token is missing required scope "+ScopeAdmin, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
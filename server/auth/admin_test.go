@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRevokeSessions_RejectsOldTokens(t *testing.T) {
+	// arrange
+	user := "revoked@bar.com"
+	oldToken := CreateToken(&user)
+	// act
+	RevokeSessions(user)
+	newToken := CreateToken(&user)
+	// assert
+	if _, err := ParseToken("Bearer " + oldToken); err != ErrRevoked {
+		t.Errorf("Expected revoked token to be rejected, got: %v", err)
+	}
+
+	if _, err := ParseToken("Bearer " + newToken); err != nil {
+		t.Errorf("Token issued after revocation was rejected: %v", err)
+	}
+}
+
+func TestBan(t *testing.T) {
+	// arrange
+	user := "banned@bar.com"
+	RegisterClient(user, [32]byte{1})
+	token := CreateToken(&user)
+	// act
+	Ban(user)
+	// assert
+	if _, err := ParseToken("Bearer " + token); err != ErrBanned {
+		t.Errorf("Expected token of banned user to be rejected, got: %v", err)
+	}
+
+	if IsRegistered(user) {
+		t.Error("Banned user is still in the directory")
+	}
+
+	Unban(user)
+	if IsBanned(user) {
+		t.Error("User is still banned")
+	}
+}
+
+func TestUsers(t *testing.T) {
+	// arrange
+	user := "listed@bar.com"
+	RegisterClient(user, [32]byte{2})
+	// act
+	users := Users()
+	// assert
+	for _, u := range users {
+		if u.UserName == user {
+			if u.Fingerprint != Fingerprint([32]byte{2}) || len(u.Fingerprint) != 32 {
+				t.Errorf("Unexpected fingerprint: %v", u.Fingerprint)
+			}
+			return
+		}
+	}
+	t.Error("Registered user is not listed")
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	var adminTable = []struct {
+		adminToken string
+		header     string
+		expected   int
+	}{
+		{"secret", "Bearer secret", http.StatusOK},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, entry := range adminTable {
+		// arrange
+		handler := AdminMiddleware(entry.adminToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest("GET", "/admin/users", nil)
+		req.Header.Set("Authorization", entry.header)
+		wr := httptest.NewRecorder()
+		// act
+		handler.ServeHTTP(wr, req)
+		// assert
+		if wr.Code != entry.expected {
+			t.Errorf("Unexpected status code for %q. expected: %v, actual %v", entry.header, entry.expected, wr.Code)
+		}
+	}
+}
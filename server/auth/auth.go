@@ -2,42 +2,59 @@ package auth
 
 import (
 	"errors"
-	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"strings"
 
+	"ciphertalk/common/models"
+	"ciphertalk/server/metrics"
+
 	"github.com/auth0/go-jwt-middleware"
 	"github.com/dgrijalva/jwt-go"
 )
 
-var appSecret = []byte("super-secret-secret")
-var tokenExpiration = time.Duration(24)
-
 var JwtMiddleware = jwtmiddleware.New(jwtmiddleware.Options{
-	ValidationKeyGetter: func(token *jwt.Token) (interface{}, error) {
-		return appSecret, nil
-	},
+	ValidationKeyGetter: verificationKey,
 	// When set, the middleware verifies that tokens are signed with the specific signing algorithm
 	// If the signing method is not constant the ValidationKeyGetter callback can be used to implement additional checks
 	// Important to avoid security issues described here: https://auth0.com/blog/2015/03/31/critical-vulnerabilities-in-json-web-token-libraries/
-	SigningMethod: jwt.SigningMethodHS256,
+	SigningMethod: jwt.SigningMethodES256,
 })
 
+var logger = slog.Default()
+
+// SetLogger sets the structured logger used by the auth package
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
 // list of available chat clients. Map of username (string) to public key (32 bytes)
-var registeredClients = make(map[string][32]byte)
+var registeredClients = make(map[string]models.Key32)
+var registeredClientsMutex sync.RWMutex
 
+// CreateToken issues a token with the default scopes
 func CreateToken(userName *string) string {
+	return CreateScopedToken(userName, DefaultScopes)
+}
+
+// CreateScopedToken issues a token which grants scopes
+func CreateScopedToken(userName *string, scopes []string) string {
 	// Create new auth token
-	token := jwt.New(jwt.SigningMethodHS256)
+	token := jwt.New(jwt.SigningMethodES256)
+	key := currentSigningKey()
+	token.Header["kid"] = key.id
 
 	// Set token claims
 	claims := token.Claims.(jwt.MapClaims)
 	claims["name"] = userName
-	claims["expires"] = time.Now().Add(time.Hour * tokenExpiration).Unix()
+	claims["gen"] = sessionGeneration(*userName)
+	claims["scope"] = strings.Join(scopes, " ")
+	claims["exp"] = time.Now().Add(TokenLifetime).Unix()
 
-	// Sign the token with our secret
-	tokenString, _ := token.SignedString(appSecret)
+	// Sign the token with the current signing key
+	tokenString, _ := token.SignedString(key.privateKey)
 
 	return tokenString
 }
@@ -45,6 +62,7 @@ func CreateToken(userName *string) string {
 type UserProfile struct {
 	AuthToken string
 	UserName  string
+	Scopes    []string
 }
 
 func ParseToken(authHeader string) (UserProfile, error) {
@@ -56,21 +74,31 @@ func ParseToken(authHeader string) (UserProfile, error) {
 		return userProfile, errors.New("invalid authorization header")
 	}
 	tokenVal := pieces[1]
-	token, err := jwt.Parse(tokenVal, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return appSecret, nil
-	})
+	token, err := jwt.Parse(tokenVal, verificationKey)
 
 	if err != nil {
+		logger.Debug("token rejected", "error", err)
 		return userProfile, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		userName, _ := claims["name"].(string)
+		if userName == "" {
+			return userProfile, errors.New("token has no user name")
+		}
+
+		// tokens issued before generations were introduced have no generation, same as generation 0
+		gen, _ := claims["gen"].(float64)
+		if IsBanned(userName) {
+			return userProfile, ErrBanned
+		}
+		if int(gen) != sessionGeneration(userName) {
+			return userProfile, ErrRevoked
+		}
+
 		userProfile.AuthToken = tokenVal
-		userProfile.UserName = claims["name"].(string)
+		userProfile.UserName = userName
+		userProfile.Scopes = parseScopes(claims["scope"])
 
 		return userProfile, nil
 	}
@@ -78,15 +106,32 @@ func ParseToken(authHeader string) (UserProfile, error) {
 	return userProfile, err
 }
 
-func RegisterClient(userName string, pubKey [32]byte) {
+func RegisterClient(userName string, pubKey models.Key32) {
+	registeredClientsMutex.Lock()
 	registeredClients[userName] = pubKey
+	registeredClientsMutex.Unlock()
+	logger.Info("client registered", "user", userName)
 }
 
-func RetrieveClient(userName string) ([32]byte, error) {
-	var res [32]byte
+func RetrieveClient(userName string) (models.Key32, error) {
+	registeredClientsMutex.RLock()
+	defer registeredClientsMutex.RUnlock()
+
+	var res models.Key32
 	if res, ok := registeredClients[userName]; ok {
+		metrics.SecureLookups.With("hit").Inc()
 		return res, nil
 	}
 
+	metrics.SecureLookups.With("miss").Inc()
 	return res, errors.New("entry not found for key " + userName)
 }
+
+// IsRegistered returns true if client with a given user name has logged in
+func IsRegistered(userName string) bool {
+	registeredClientsMutex.RLock()
+	defer registeredClientsMutex.RUnlock()
+
+	_, ok := registeredClients[userName]
+	return ok
+}
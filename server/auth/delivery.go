@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Delivery certificates are signed with their own key, so they can never be used as auth tokens and vice versa.
+// The key lives only in memory; certificates are short-lived and a restart just makes clients request new ones.
+var deliverySecret = randomSecret()
+
+// DeliveryCertificateExpiration is how long a delivery certificate stays valid at least
+var DeliveryCertificateExpiration = 5 * time.Minute
+
+// DeliveryCertificateWindow is what expiry of delivery certificates is rounded up to. Certificates issued in the
+// same window are identical, so a sealed message does not reveal when its sender fetched the certificate.
+var DeliveryCertificateWindow = 5 * time.Minute
+
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// CreateDeliveryCertificate issues a short-lived certificate which authorizes delivery of sealed sender messages.
+// It does not carry the identity of the user it was issued to.
+func CreateDeliveryCertificate() (string, time.Time) {
+	expires := time.Now().Add(DeliveryCertificateExpiration)
+	if rounded := expires.Truncate(DeliveryCertificateWindow); rounded.Before(expires) {
+		expires = rounded.Add(DeliveryCertificateWindow)
+	}
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["exp"] = expires.Unix()
+
+	certificate, _ := token.SignedString(deliverySecret)
+
+	return certificate, expires
+}
+
+// VerifyDeliveryCertificate returns an error if certificate was not issued by this server or has expired
+func VerifyDeliveryCertificate(certificate string) error {
+	if certificate == "" {
+		return errors.New("missing delivery certificate")
+	}
+
+	token, err := jwt.Parse(certificate, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return deliverySecret, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if !token.Valid {
+		return errors.New("invalid delivery certificate")
+	}
+
+	return nil
+}
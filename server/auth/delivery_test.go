@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateDeliveryCertificate_RoundsExpiry(t *testing.T) {
+	// arrange
+	earliest := time.Now().Add(DeliveryCertificateExpiration).Truncate(time.Second)
+	// act
+	certificate, expires := CreateDeliveryCertificate()
+	other, otherExpires := CreateDeliveryCertificate()
+	// assert
+	if expires.Before(earliest) || !expires.Equal(expires.Truncate(DeliveryCertificateWindow)) {
+		t.Errorf("Expiry should be rounded up to the window: %v", expires)
+	}
+
+	if expires.Equal(otherExpires) && certificate != other {
+		t.Error("Certificates issued in the same window should be identical")
+	}
+
+	if err := VerifyDeliveryCertificate(certificate); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
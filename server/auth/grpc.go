@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCScopes maps full gRPC method names to the scope a token needs to call them.
+// Methods which are not listed can be called without a token.
+type GRPCScopes map[string]string
+
+type profileContextKey struct{}
+
+// ProfileFromContext returns the user who made an authenticated gRPC call
+func ProfileFromContext(ctx context.Context) (UserProfile, bool) {
+	user, ok := ctx.Value(profileContextKey{}).(UserProfile)
+	return user, ok
+}
+
+// UnaryInterceptor authenticates unary calls with the token from "authorization" metadata, like RequireScope does for HTTP
+func (scopes GRPCScopes) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := scopes.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor authenticates streaming calls with the token from "authorization" metadata
+func (scopes GRPCScopes) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := scopes.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (scopes GRPCScopes) authorize(ctx context.Context, method string) (context.Context, error) {
+	scope, ok := scopes[method]
+	if !ok {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return ctx, status.Error(codes.Unauthenticated, "Missing bearer token in authorization metadata")
+	}
+
+	user, err := ParseToken(values[0])
+	if err != nil {
+		logger.Debug("grpc token rejected", "error", err, "method", method)
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	if !user.HasScope(scope) {
+		logger.Warn("missing scope", "user", user.UserName, "scope", scope, "method", method)
+		return ctx, status.Error(codes.PermissionDenied, "Forbidden. Token is missing required scope "+scope)
+	}
+
+	return context.WithValue(ctx, profileContextKey{}, user), nil
+}
+
+// authenticatedStream carries the caller's profile in the context of a streaming call
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCScopes_UnaryInterceptor(t *testing.T) {
+	user := "grpc@bar.com"
+	scopes := GRPCScopes{"/test/Secured": ScopeChatSend}
+	var scopeTable = []struct {
+		method   string
+		header   string
+		expected codes.Code
+	}{
+		{"/test/Secured", "Bearer " + CreateToken(&user), codes.OK},
+		{"/test/Secured", "Bearer " + CreateScopedToken(&user, []string{ScopeDirectoryRead}), codes.PermissionDenied},
+		{"/test/Secured", "Bearer invalid", codes.Unauthenticated},
+		{"/test/Secured", "", codes.Unauthenticated},
+		{"/test/Public", "", codes.OK},
+	}
+
+	for _, entry := range scopeTable {
+		// arrange
+		ctx := context.Background()
+		if entry.header != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", entry.header))
+		}
+
+		var profile UserProfile
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			profile, _ = ProfileFromContext(ctx)
+			return nil, nil
+		}
+
+		// act
+		_, err := scopes.UnaryInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: entry.method}, handler)
+
+		// assert
+		if status.Code(err) != entry.expected {
+			t.Errorf("Expected %v for %v with %q, got %v", entry.expected, entry.method, entry.header, err)
+		}
+
+		if entry.expected == codes.OK && entry.header != "" && profile.UserName != user {
+			t.Errorf("Expected profile of %v in context, got %v", user, profile)
+		}
+	}
+}
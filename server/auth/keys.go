@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ciphertalk/common/constants"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenLifetime is how long auth tokens stay valid
+var TokenLifetime = 24 * time.Hour
+
+// JWKSMaxAge is how long verifiers may cache the published key set. New keys are published this long
+// before they sign tokens, so verifiers with a cached key set never see an unknown kid.
+var JWKSMaxAge = 5 * time.Minute
+
+// ErrUnknownKey is returned for tokens signed with a key which is not in the key ring
+var ErrUnknownKey = errors.New("token is signed with an unknown key")
+
+type signingKey struct {
+	id         string
+	privateKey *ecdsa.PrivateKey
+	// activates is when the key starts signing tokens, until then it is only published
+	activates time.Time
+}
+
+// Tokens are signed with ES256 so other services can verify them with the public keys published as JWKS
+// without being able to mint tokens. Keys live only in memory, a restart makes clients log in again.
+// The newest key comes first.
+var signingKeys []*signingKey
+var signingKeysMutex sync.RWMutex
+
+func init() {
+	if err := RotateSigningKey(); err != nil {
+		panic(err)
+	}
+}
+
+// RotateSigningKey generates a new signing key which is published right away and signs tokens after JWKSMaxAge.
+// Replaced keys keep verifying tokens until TokenLifetime passes.
+func RotateSigningKey() error {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return err
+	}
+
+	signingKeysMutex.Lock()
+	defer signingKeysMutex.Unlock()
+
+	t := time.Now()
+	next := &signingKey{id: hex.EncodeToString(id), privateKey: privateKey, activates: t}
+	// the first key signs right away, nobody can have cached the key set yet
+	if len(signingKeys) > 0 {
+		next.activates = t.Add(JWKSMaxAge)
+	}
+
+	// a key signs tokens until the next key activates, its tokens expire TokenLifetime later
+	kept := []*signingKey{next}
+	replaced := next.activates
+	for _, key := range signingKeys {
+		if replaced.Sub(t) > -TokenLifetime {
+			kept = append(kept, key)
+		}
+		if key.activates.Before(replaced) {
+			replaced = key.activates
+		}
+	}
+
+	if len(signingKeys) > 0 {
+		logger.Info("signing key rotated", "kid", next.id, "activates", next.activates, "keys", len(kept))
+	}
+	signingKeys = kept
+	return nil
+}
+
+// StartKeyRotation rotates the signing key every interval, zero interval keeps the key until restart
+func StartKeyRotation(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := RotateSigningKey(); err != nil {
+				logger.Error("unable to rotate signing key", "error", err)
+			}
+		}
+	}()
+}
+
+// currentSigningKey returns the newest key which has been published for JWKSMaxAge
+func currentSigningKey() *signingKey {
+	signingKeysMutex.RLock()
+	defer signingKeysMutex.RUnlock()
+
+	t := time.Now()
+	for _, key := range signingKeys {
+		if !key.activates.After(t) {
+			return key
+		}
+	}
+
+	return signingKeys[len(signingKeys)-1]
+}
+
+// verificationKey returns the public key for the kid in the token header
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	signingKeysMutex.RLock()
+	defer signingKeysMutex.RUnlock()
+
+	for _, key := range signingKeys {
+		if key.id == kid {
+			return &key.privateKey.PublicKey, nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// JSONWebKey is a public signing key in JWK format
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// JSONWebKeySet returns public keys of all signing keys which still verify tokens or will sign them soon
+func JSONWebKeySet() []JSONWebKey {
+	signingKeysMutex.RLock()
+	defer signingKeysMutex.RUnlock()
+
+	var keys []JSONWebKey
+	for _, key := range signingKeys {
+		public := key.privateKey.PublicKey
+		keys = append(keys, JSONWebKey{
+			KeyType:   "EC",
+			Curve:     "P-256",
+			X:         base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+			Y:         base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+			KeyID:     key.id,
+			Algorithm: jwt.SigningMethodES256.Alg(),
+			Use:       "sig",
+		})
+	}
+
+	return keys
+}
+
+// JWKSHandler serves the public signing keys at /.well-known/jwks.json
+func JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := json.Marshal(struct {
+			Keys []JSONWebKey `json:"keys"`
+		}{JSONWebKeySet()})
+
+		w.Header().Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(JWKSMaxAge.Seconds())))
+		w.Write(payload)
+	})
+}
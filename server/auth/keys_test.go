@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestRotateSigningKey_KeepsOldTokensValid(t *testing.T) {
+	// arrange
+	user := "rotated@bar.com"
+	token := CreateToken(&user)
+	// act
+	RotateSigningKey()
+	// assert
+	if _, err := ParseToken("Bearer " + token); err != nil {
+		t.Error("Token signed with the previous key was rejected:", err)
+	}
+}
+
+func TestRotateSigningKey_DropsExpiredKeys(t *testing.T) {
+	// arrange
+	lifetime, maxAge := TokenLifetime, JWKSMaxAge
+	defer func() { TokenLifetime, JWKSMaxAge = lifetime, maxAge }()
+	TokenLifetime, JWKSMaxAge = 0, 0
+	old := currentSigningKey().id
+	// act
+	RotateSigningKey()
+	// assert
+	for _, key := range JSONWebKeySet() {
+		if key.KeyID == old {
+			t.Error("Key which can no longer sign valid tokens was kept")
+		}
+	}
+}
+
+func TestRotateSigningKey_PublishesBeforeSigning(t *testing.T) {
+	// arrange
+	current := currentSigningKey().id
+	// act
+	RotateSigningKey()
+	// assert
+	if currentSigningKey().id != current {
+		t.Error("New key signs tokens before verifiers could have fetched it")
+	}
+
+	if keys := JSONWebKeySet(); keys[0].KeyID == current {
+		t.Error("New key is not published")
+	}
+}
+
+func TestParseToken_RejectsHMAC(t *testing.T) {
+	// arrange
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"name": "mallory", "exp": time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = currentSigningKey().id
+	signed, _ := token.SignedString([]byte("super-secret-secret"))
+	// act
+	_, err := ParseToken("Bearer " + signed)
+	// assert
+	if err == nil {
+		t.Error("HMAC signed token was accepted")
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	// arrange
+	user := "jwks@bar.com"
+	token := CreateToken(&user)
+	wr := httptest.NewRecorder()
+	// act
+	JWKSHandler().ServeHTTP(wr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	// assert
+	if !strings.Contains(wr.Body.String(), "\"kid\":\""+currentSigningKey().id+"\"") {
+		t.Fatal("Current key is not published:", wr.Body.String())
+	}
+
+	// verify the token using only the published key, like another service would
+	var jwk JSONWebKey
+	for _, key := range JSONWebKeySet() {
+		if key.KeyID == currentSigningKey().id {
+			jwk = key
+		}
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+	y, _ := base64.RawURLEncoding.DecodeString(jwk.Y)
+	public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+	_, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return public, nil })
+	if err != nil {
+		t.Error("Token does not verify with the published key:", err)
+	}
+}
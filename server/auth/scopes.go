@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"ciphertalk/common/constants"
+)
+
+// Scopes carried by auth tokens
+const (
+	// ScopeChatSend allows connecting to the websocket, sending messages and exchanging files
+	ScopeChatSend = "chat:send"
+	// ScopeDirectoryRead allows looking up public keys of other users
+	ScopeDirectoryRead = "directory:read"
+	// ScopeAdmin allows using the admin API
+	ScopeAdmin = "admin"
+)
+
+// KnownScopes lists every scope the server checks
+var KnownScopes = []string{ScopeChatSend, ScopeDirectoryRead, ScopeAdmin}
+
+// DefaultScopes are granted to tokens issued on login
+var DefaultScopes = []string{ScopeChatSend, ScopeDirectoryRead}
+
+// HasScope returns true if the token the profile was parsed from grants scope
+func (p UserProfile) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// parseScopes splits the space separated scope claim. Tokens issued before scopes were introduced have no claim
+// and get the default scopes.
+func parseScopes(claim interface{}) []string {
+	scope, ok := claim.(string)
+	if !ok {
+		return DefaultScopes
+	}
+	return strings.Fields(scope)
+}
+
+// RequireScope validates the JWT like Middleware and rejects tokens which do not grant scope with 403
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := ParseToken(r.Header.Get(constants.HTTPAuthorization))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if !user.HasScope(scope) {
+			logger.Warn("missing scope", "user", user.UserName, "scope", scope, "path", r.URL.Path)
+			http.Error(w, "Forbidden. Token is missing required scope "+scope, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseToken_Scopes(t *testing.T) {
+	// arrange
+	user := "scoped@bar.com"
+	token := CreateScopedToken(&user, []string{ScopeAdmin})
+	// act
+	result, err := ParseToken("Bearer " + token)
+	// assert
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	if !result.HasScope(ScopeAdmin) || result.HasScope(ScopeChatSend) {
+		t.Errorf("Unexpected scopes: %v", result.Scopes)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	user := "scoped@bar.com"
+	var scopeTable = []struct {
+		scope    string
+		header   string
+		expected int
+	}{
+		{ScopeChatSend, "Bearer " + CreateToken(&user), http.StatusOK},
+		{ScopeDirectoryRead, "Bearer " + CreateToken(&user), http.StatusOK},
+		{ScopeAdmin, "Bearer " + CreateToken(&user), http.StatusForbidden},
+		{ScopeChatSend, "Bearer " + CreateScopedToken(&user, []string{ScopeDirectoryRead}), http.StatusForbidden},
+		{ScopeChatSend, "", http.StatusUnauthorized},
+	}
+
+	for _, entry := range scopeTable {
+		// arrange
+		handler := RequireScope(entry.scope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest("GET", "/secure", nil)
+		req.Header.Set("Authorization", entry.header)
+		wr := httptest.NewRecorder()
+		// act
+		handler.ServeHTTP(wr, req)
+		// assert
+		if wr.Code != entry.expected {
+			t.Errorf("Unexpected status code for scope %v. expected: %v, actual %v", entry.scope, entry.expected, wr.Code)
+		}
+	}
+}
+
+func TestAdminMiddleware_AdminScope(t *testing.T) {
+	// arrange
+	user := "operator@bar.com"
+	handler := AdminMiddleware("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/admin/users", nil)
+	req.Header.Set("Authorization", "Bearer "+CreateScopedToken(&user, []string{ScopeAdmin}))
+	wr := httptest.NewRecorder()
+	// act
+	handler.ServeHTTP(wr, req)
+	// assert
+	if wr.Code != http.StatusOK {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusOK, wr.Code)
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTicket is returned for unknown, expired or already used websocket tickets
+var ErrInvalidTicket = errors.New("invalid websocket ticket")
+
+// ErrTooManyTickets is returned when the user already holds MaxWebsocketTickets unredeemed tickets
+var ErrTooManyTickets = errors.New("too many outstanding websocket tickets")
+
+// WebsocketTicketExpiration is how long a websocket ticket can be redeemed
+var WebsocketTicketExpiration = 30 * time.Second
+
+// MaxWebsocketTickets is how many unexpired tickets a user may hold before redeeming them
+var MaxWebsocketTickets = 5
+
+type ticket struct {
+	user    UserProfile
+	expires time.Time
+}
+
+// outstanding websocket tickets. Map of ticket to the profile of the user it was issued to
+var tickets = make(map[string]ticket)
+
+// ticket ids issued to each user, they may include redeemed or expired tickets until the user's next ticket
+var ticketsByUser = make(map[string][]string)
+
+// expired tickets of all users are removed at most once per WebsocketTicketExpiration
+var ticketsPruned time.Time
+var ticketsMutex sync.Mutex
+
+// CreateWebsocketTicket issues a single-use ticket which opens a websocket on behalf of the user.
+// Browsers pass it as a query parameter because they can not set headers on the upgrade request.
+func CreateWebsocketTicket(user UserProfile) (string, time.Time, error) {
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return "", time.Time{}, err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(value)
+	t := time.Now()
+	expires := t.Add(WebsocketTicketExpiration)
+
+	ticketsMutex.Lock()
+	defer ticketsMutex.Unlock()
+
+	if t.Sub(ticketsPruned) >= WebsocketTicketExpiration {
+		pruneTickets(t)
+		ticketsPruned = t
+	}
+
+	outstanding := liveTickets(ticketsByUser[user.UserName], t)
+	if len(outstanding) >= MaxWebsocketTickets {
+		ticketsByUser[user.UserName] = outstanding
+		return "", time.Time{}, ErrTooManyTickets
+	}
+
+	tickets[id] = ticket{user: user, expires: expires}
+	ticketsByUser[user.UserName] = append(outstanding, id)
+	return id, expires, nil
+}
+
+// liveTickets returns the ids which can still be redeemed and deletes expired tickets
+func liveTickets(ids []string, t time.Time) []string {
+	var live []string
+	for _, id := range ids {
+		tk, ok := tickets[id]
+		if ok && t.Before(tk.expires) {
+			live = append(live, id)
+		} else if ok {
+			delete(tickets, id)
+		}
+	}
+	return live
+}
+
+func pruneTickets(t time.Time) {
+	for user, ids := range ticketsByUser {
+		if live := liveTickets(ids, t); len(live) > 0 {
+			ticketsByUser[user] = live
+		} else {
+			delete(ticketsByUser, user)
+		}
+	}
+}
+
+// RedeemWebsocketTicket returns the profile the ticket was issued to. A ticket can only be redeemed once.
+func RedeemWebsocketTicket(id string) (UserProfile, error) {
+	ticketsMutex.Lock()
+	tk, ok := tickets[id]
+	delete(tickets, id)
+	ticketsMutex.Unlock()
+
+	if !ok || !time.Now().Before(tk.expires) {
+		return UserProfile{}, ErrInvalidTicket
+	}
+
+	return tk.user, nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedeemWebsocketTicket_SingleUse(t *testing.T) {
+	// arrange
+	user := UserProfile{UserName: "ticket@bar.com", AuthToken: "token"}
+	ticket, _, _ := CreateWebsocketTicket(user)
+	// act
+	result, err := RedeemWebsocketTicket(ticket)
+	_, replayErr := RedeemWebsocketTicket(ticket)
+	// assert
+	if err != nil || result.UserName != user.UserName || result.AuthToken != user.AuthToken {
+		t.Errorf("Unexpected result: %v %v", result, err)
+	}
+
+	if replayErr != ErrInvalidTicket {
+		t.Error("Ticket was redeemed twice")
+	}
+}
+
+func TestRedeemWebsocketTicket_Expired(t *testing.T) {
+	// arrange
+	expiration := WebsocketTicketExpiration
+	defer func() { WebsocketTicketExpiration = expiration }()
+	WebsocketTicketExpiration = -time.Second
+	ticket, _, _ := CreateWebsocketTicket(UserProfile{UserName: "ticket@bar.com"})
+	// act
+	_, err := RedeemWebsocketTicket(ticket)
+	// assert
+	if err != ErrInvalidTicket {
+		t.Error("Expired ticket was accepted")
+	}
+}
+
+func TestCreateWebsocketTicket_Limit(t *testing.T) {
+	// arrange
+	user := UserProfile{UserName: "tickets@bar.com"}
+	var ids []string
+	for i := 0; i < MaxWebsocketTickets; i++ {
+		id, _, _ := CreateWebsocketTicket(user)
+		ids = append(ids, id)
+	}
+	// act
+	_, _, err := CreateWebsocketTicket(user)
+	_, _, otherErr := CreateWebsocketTicket(UserProfile{UserName: "other-tickets@bar.com"})
+	RedeemWebsocketTicket(ids[0])
+	_, _, redeemedErr := CreateWebsocketTicket(user)
+	// assert
+	if err != ErrTooManyTickets {
+		t.Errorf("Expected too many tickets, actual: %v", err)
+	}
+
+	if otherErr != nil {
+		t.Errorf("Tickets of one user should not limit others, actual: %v", otherErr)
+	}
+
+	if redeemedErr != nil {
+		t.Errorf("Redeemed ticket should free up the limit, actual: %v", redeemedErr)
+	}
+}
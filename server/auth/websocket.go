@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"ciphertalk/common/constants"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebsocketToken lets browsers authenticate websocket upgrades and event streams, which can not carry
+// the Authorization header.
+// If the header is missing, the token is taken from a single-use "ticket" query parameter
+// or from a "bearer.<token>" websocket subprotocol.
+func WebsocketToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("ticket"); id != "" && r.Header.Get(constants.HTTPAuthorization) == "" {
+			user, err := RedeemWebsocketTicket(id)
+			if err != nil {
+				logger.Debug("websocket ticket rejected", "error", err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			// the ticket stands in for the token it was issued for, so revocation and scopes still apply
+			r.Header.Set(constants.HTTPAuthorization, "Bearer "+user.AuthToken)
+		}
+
+		if r.Header.Get(constants.HTTPAuthorization) == "" {
+			for _, protocol := range websocket.Subprotocols(r) {
+				if strings.HasPrefix(protocol, constants.WebsocketTokenPrefix) {
+					r.Header.Set(constants.HTTPAuthorization, "Bearer "+strings.TrimPrefix(protocol, constants.WebsocketTokenPrefix))
+					break
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebsocketToken(t *testing.T) {
+	var protocolTable = []struct {
+		authorization string
+		protocols     string
+		expected      string
+	}{
+		{"", "ciphertalk, bearer.abc.def", "Bearer abc.def"},
+		{"Bearer header", "ciphertalk, bearer.abc.def", "Bearer header"},
+		{"", "ciphertalk", ""},
+	}
+
+	for _, entry := range protocolTable {
+		// arrange
+		var actual string
+		handler := WebsocketToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actual = r.Header.Get("Authorization")
+		}))
+		req := httptest.NewRequest("GET", "/websockets", nil)
+		req.Header.Set("Authorization", entry.authorization)
+		req.Header.Set("Sec-WebSocket-Protocol", entry.protocols)
+		// act
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		// assert
+		if actual != entry.expected {
+			t.Errorf("Unexpected authorization for %q. expected: %q, actual %q", entry.protocols, entry.expected, actual)
+		}
+	}
+}
+
+func TestWebsocketToken_Ticket(t *testing.T) {
+	// arrange
+	ticket, _, _ := CreateWebsocketTicket(UserProfile{UserName: "ticket@bar.com", AuthToken: "abc.def"})
+	var ticketTable = []struct {
+		query    string
+		code     int
+		expected string
+	}{
+		{"?ticket=" + ticket, http.StatusOK, "Bearer abc.def"},
+		{"?ticket=" + ticket, http.StatusUnauthorized, ""},
+		{"?ticket=unknown", http.StatusUnauthorized, ""},
+	}
+
+	for _, entry := range ticketTable {
+		var actual string
+		handler := WebsocketToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actual = r.Header.Get("Authorization")
+		}))
+		wr := httptest.NewRecorder()
+		// act
+		handler.ServeHTTP(wr, httptest.NewRequest("GET", "/websockets"+entry.query, nil))
+		// assert
+		if wr.Code != entry.code || actual != entry.expected {
+			t.Errorf("Unexpected result for %v. code: %v, authorization: %q", entry.query, wr.Code, actual)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package blobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// now is replaced in tests to control the clock
+var now = time.Now
+
+// ErrNotFound is returned when there is no blob for a given hash
+var ErrNotFound = errors.New("blob not found")
+
+// ErrHashMismatch is returned when blob content does not match the hash it is stored under
+var ErrHashMismatch = errors.New("blob content does not match its hash")
+
+// ErrTooLarge is returned when a blob exceeds the maximum blob size
+var ErrTooLarge = errors.New("blob is too large")
+
+// ErrStoreFull is returned when storing a blob would exceed the store capacity
+var ErrStoreFull = errors.New("blob store is full")
+
+// ErrQuotaExceeded is returned when storing a blob would exceed the uploader's quota
+var ErrQuotaExceeded = errors.New("blob quota exceeded")
+
+// ErrNotOwner is returned when a user deletes a blob uploaded by someone else
+var ErrNotOwner = errors.New("blob belongs to another user")
+
+// Limits restrict how much the store keeps. Zero limits mean unlimited.
+type Limits struct {
+	// MaxBlobSize is the largest blob in bytes
+	MaxBlobSize int64
+	// Capacity is the total size in bytes of all blobs
+	Capacity int64
+	// Quota is the total size in bytes of blobs uploaded by one user
+	Quota int64
+	// Retention is how long blobs are kept after their upload
+	Retention time.Duration
+}
+
+// blob is shared by everyone who uploaded the same chunk, each owner is charged its size
+type blob struct {
+	data    []byte
+	owners  map[string]bool
+	expires time.Time
+}
+
+// Store keeps encrypted file chunks in memory keyed by sha256 of their content.
+// The server never sees plaintext or keys, only opaque chunks.
+type Store struct {
+	mutex  sync.RWMutex
+	blobs  map[string]blob
+	size   int64
+	usage  map[string]int64
+	limits Limits
+}
+
+// NewStore creates new instance of Store
+func NewStore(limits Limits) *Store {
+	return &Store{blobs: make(map[string]blob), usage: make(map[string]int64), limits: limits}
+}
+
+// MaxBlobSize returns the largest blob the store accepts
+func (s *Store) MaxBlobSize() int64 {
+	return s.limits.MaxBlobSize
+}
+
+// Hash returns hex encoded sha256 of data
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidHash returns true if hash looks like hex encoded sha256
+func ValidHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Put stores data uploaded by owner under hash after verifying its content
+func (s *Store) Put(owner string, hash string, data []byte) error {
+	if s.limits.MaxBlobSize > 0 && int64(len(data)) > s.limits.MaxBlobSize {
+		return ErrTooLarge
+	}
+
+	if Hash(data) != hash {
+		return ErrHashMismatch
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	size := int64(len(data))
+	b, ok := s.blobs[hash]
+	if ok && b.expired(now()) {
+		s.remove(hash, b)
+		ok = false
+	}
+
+	if !ok {
+		if s.limits.Capacity > 0 && s.size+size > s.limits.Capacity {
+			return ErrStoreFull
+		}
+		b = blob{data: data, owners: make(map[string]bool)}
+	}
+
+	if !b.owners[owner] {
+		if s.limits.Quota > 0 && s.usage[owner]+size > s.limits.Quota {
+			return ErrQuotaExceeded
+		}
+		b.owners[owner] = true
+		s.usage[owner] += size
+	}
+
+	// every upload keeps the chunk for the whole retention, a later message may still refer to it
+	if s.limits.Retention > 0 {
+		b.expires = now().Add(s.limits.Retention)
+	}
+	if !ok {
+		s.size += size
+	}
+	s.blobs[hash] = b
+	return nil
+}
+
+// Get returns blob stored under hash
+func (s *Store) Get(hash string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if b, ok := s.blobs[hash]; ok && !b.expired(now()) {
+		return b.data, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// Delete releases the owner's upload of the blob stored under hash, only users who uploaded it may delete it.
+// The blob is removed once none of its uploaders keep it.
+func (s *Store) Delete(owner string, hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.blobs[hash]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if !b.owners[owner] {
+		return ErrNotOwner
+	}
+
+	if len(b.owners) == 1 {
+		s.remove(hash, b)
+		return nil
+	}
+
+	delete(b.owners, owner)
+	s.release(owner, int64(len(b.data)))
+	return nil
+}
+
+// Purge removes expired blobs and returns how many were removed
+func (s *Store) Purge() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	purged := 0
+	t := now()
+	for hash, b := range s.blobs {
+		if b.expired(t) {
+			s.remove(hash, b)
+			purged++
+		}
+	}
+
+	return purged
+}
+
+func (s *Store) remove(hash string, b blob) {
+	size := int64(len(b.data))
+	s.size -= size
+	for owner := range b.owners {
+		s.release(owner, size)
+	}
+	delete(s.blobs, hash)
+}
+
+func (s *Store) release(owner string, size int64) {
+	if s.usage[owner] -= size; s.usage[owner] <= 0 {
+		delete(s.usage, owner)
+	}
+}
+
+func (b blob) expired(t time.Time) bool {
+	return !b.expires.IsZero() && t.After(b.expires)
+}
@@ -0,0 +1,160 @@
+package blobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPutAndGet(t *testing.T) {
+	// arrange
+	store := NewStore(Limits{})
+	data := []byte("sealed chunk")
+	hash := Hash(data)
+	// act
+	err := store.Put("foo", hash, data)
+	result, getErr := store.Get(hash)
+	// assert
+	if err != nil || getErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v", err, getErr)
+	}
+
+	if string(result) != string(data) {
+		t.Error("Blob was not stored correctly")
+	}
+}
+
+func TestPut_Errors(t *testing.T) {
+	store := NewStore(Limits{MaxBlobSize: 4, Capacity: 6})
+	small := []byte("abc")
+
+	if err := store.Put("foo", Hash([]byte("other")), small); err != ErrHashMismatch {
+		t.Errorf("Expected hash mismatch, actual: %v", err)
+	}
+
+	if err := store.Put("foo", Hash([]byte("too long")), []byte("too long")); err != ErrTooLarge {
+		t.Errorf("Expected blob to be too large, actual: %v", err)
+	}
+
+	store.Put("foo", Hash(small), small)
+	if err := store.Put("foo", Hash([]byte("defg")), []byte("defg")); err != ErrStoreFull {
+		t.Errorf("Expected store to be full, actual: %v", err)
+	}
+
+	if err := store.Delete("bar", Hash(small)); err != ErrNotOwner {
+		t.Errorf("Expected only the owner to delete a blob, actual: %v", err)
+	}
+
+	store.Delete("foo", Hash(small))
+	if err := store.Put("foo", Hash([]byte("defg")), []byte("defg")); err != nil {
+		t.Errorf("Deleted blob should free up capacity, actual: %v", err)
+	}
+}
+
+func TestPut_Quota(t *testing.T) {
+	// arrange
+	store := NewStore(Limits{Quota: 6})
+	store.Put("foo", Hash([]byte("abcd")), []byte("abcd"))
+
+	// act
+	err := store.Put("foo", Hash([]byte("efgh")), []byte("efgh"))
+	otherErr := store.Put("bar", Hash([]byte("efgh")), []byte("efgh"))
+
+	// assert
+	if err != ErrQuotaExceeded {
+		t.Errorf("Expected quota to be exceeded, actual: %v", err)
+	}
+	if otherErr != nil {
+		t.Errorf("Quota of one user should not limit others, actual: %v", otherErr)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	// arrange
+	defer func() { now = time.Now }()
+	start := time.Now()
+	now = func() time.Time { return start }
+
+	store := NewStore(Limits{Quota: 4, Retention: time.Hour})
+	data := []byte("abcd")
+	store.Put("foo", Hash(data), data)
+
+	// act
+	now = func() time.Time { return start.Add(2 * time.Hour) }
+	_, getErr := store.Get(Hash(data))
+	purged := store.Purge()
+
+	// assert
+	if getErr != ErrNotFound {
+		t.Errorf("Expected expired blob to be gone, actual: %v", getErr)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 purged blob, actual: %v", purged)
+	}
+	if err := store.Put("foo", Hash([]byte("efgh")), []byte("efgh")); err != nil {
+		t.Errorf("Purged blob should free up quota, actual: %v", err)
+	}
+}
+
+func TestPut_ReplacesExpired(t *testing.T) {
+	// arrange
+	defer func() { now = time.Now }()
+	start := time.Now()
+	now = func() time.Time { return start }
+	store := NewStore(Limits{Retention: time.Hour})
+	data := []byte("abcd")
+	store.Put("foo", Hash(data), data)
+	// act
+	now = func() time.Time { return start.Add(2 * time.Hour) }
+	err := store.Put("bar", Hash(data), data)
+	// assert
+	if _, getErr := store.Get(Hash(data)); err != nil || getErr != nil {
+		t.Errorf("Expired blob should be replaced by a new upload: %v, %v", err, getErr)
+	}
+
+	if err := store.Delete("foo", Hash(data)); err != ErrNotOwner {
+		t.Errorf("Uploader of the expired blob should not own the new one, actual: %v", err)
+	}
+}
+
+func TestDelete_SharedBlob(t *testing.T) {
+	// arrange
+	store := NewStore(Limits{Quota: 4})
+	data := []byte("abcd")
+	store.Put("foo", Hash(data), data)
+	store.Put("bar", Hash(data), data)
+	// act
+	err := store.Delete("foo", Hash(data))
+	// assert
+	if _, getErr := store.Get(Hash(data)); err != nil || getErr != nil {
+		t.Errorf("Blob should be kept for its other uploader: %v, %v", err, getErr)
+	}
+
+	if err := store.Put("foo", Hash([]byte("efgh")), []byte("efgh")); err != nil {
+		t.Errorf("Deleted upload should free up quota, actual: %v", err)
+	}
+
+	if err := store.Delete("bar", Hash(data)); err != nil {
+		t.Errorf("Other uploader should delete the blob, actual: %v", err)
+	}
+
+	if _, getErr := store.Get(Hash(data)); getErr != ErrNotFound {
+		t.Errorf("Blob should be removed with its last uploader, actual: %v", getErr)
+	}
+}
+
+var validHashTable = []struct {
+	hash  string
+	valid bool
+}{
+	{Hash([]byte("data")), true},
+	{"abc", false},
+	{"zz" + Hash([]byte("data"))[2:], false},
+}
+
+func TestValidHash(t *testing.T) {
+	for _, entry := range validHashTable {
+		if ValidHash(entry.hash) != entry.valid {
+			t.Errorf("Unexpected result for %q, expected: %v", entry.hash, entry.valid)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ListUsers returns users in the key directory with their key fingerprints and number of connected sessions
+func (ctrl *APIController) ListUsers(w http.ResponseWriter, r *http.Request) {
+	sessions := make(map[string]int)
+	for _, cl := range ctrl.snapshotClients() {
+		sessions[cl.id]++
+	}
+
+	users := []models.UserSummary{}
+	for _, user := range auth.Users() {
+		users = append(users, models.UserSummary{
+			UserName:    user.UserName,
+			Fingerprint: user.Fingerprint,
+			Banned:      user.Banned,
+			Sessions:    sessions[user.UserName],
+		})
+	}
+
+	writeJSON(w, users)
+}
+
+// ListSessions returns connected websocket sessions
+func (ctrl *APIController) ListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := []models.SessionSummary{}
+	for _, cl := range ctrl.snapshotClients() {
+		sessions = append(sessions, models.SessionSummary{
+			ID:          cl.connID,
+			UserName:    cl.id,
+			RemoteAddr:  cl.remoteAddr,
+			ConnectedAt: cl.connectedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	writeJSON(w, sessions)
+}
+
+// Logout revokes all tokens of a user and closes its connections
+func (ctrl *APIController) Logout(w http.ResponseWriter, r *http.Request) {
+	userName := mux.Vars(r)["name"]
+
+	auth.RevokeSessions(userName)
+	ctrl.disconnect(userName)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeKey removes the user's public key from the directory, revokes its tokens and closes its connections.
+// The user has to log in again with a new key pair.
+func (ctrl *APIController) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	userName := mux.Vars(r)["name"]
+
+	if !auth.RevokeKey(userName) {
+		http.Error(w, "Client "+userName+" has not been registered", http.StatusNotFound)
+		return
+	}
+	ctrl.disconnect(userName)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Ban stops the user from logging in, removes its key from the directory and closes its connections
+func (ctrl *APIController) Ban(w http.ResponseWriter, r *http.Request) {
+	userName := mux.Vars(r)["name"]
+
+	auth.Ban(userName)
+	ctrl.disconnect(userName)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unban allows the user to log in again
+func (ctrl *APIController) Unban(w http.ResponseWriter, r *http.Request) {
+	auth.Unban(mux.Vars(r)["name"])
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IssueToken creates a token with the requested scopes, e.g. an admin token for an operator.
+// Requests authenticated with the admin token may issue tokens for any user, callers with an admin scoped JWT
+// only for themselves, so one admin can not impersonate other users. Every issued token is logged for audits.
+func (ctrl *APIController) IssueToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var tokenReq = models.TokenRequest{}
+	err := json.NewDecoder(r.Body).Decode(&tokenReq)
+
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if tokenReq.UserName == "" {
+		http.Error(w, "Invalid request. Missing user name", http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range tokenReq.Scopes {
+		if !knownScope(scope) {
+			http.Error(w, "Invalid request. Unknown scope "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// the admin token is not a JWT, so a parsed token means the caller authenticated with its own admin token
+	issuer := "admin-token"
+	if caller, err := auth.ParseToken(r.Header.Get(constants.HTTPAuthorization)); err == nil {
+		if caller.UserName != tokenReq.UserName {
+			ctrl.log().Warn("token for another user refused", "issuer", caller.UserName, "user", tokenReq.UserName)
+			http.Error(w, "Forbidden. Admin tokens may only issue tokens for their own user", http.StatusForbidden)
+			return
+		}
+		issuer = caller.UserName
+	}
+
+	ctrl.log().Info("token issued", "audit", true, "issuer", issuer, "user", tokenReq.UserName, "scopes", tokenReq.Scopes, "remote_addr", r.RemoteAddr)
+	writeJSON(w, models.LoginResponse{AuthToken: auth.CreateScopedToken(&tokenReq.UserName, tokenReq.Scopes)})
+}
+
+func knownScope(scope string) bool {
+	for _, known := range auth.KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// disconnect closes all websocket connections of a user
+func (ctrl *APIController) disconnect(userName string) {
+	for _, cl := range ctrl.snapshotClients() {
+		if cl.id == userName {
+			cl.logger.Info("client disconnected by admin")
+			ctrl.removeClient(cl)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	payload, _ := json.Marshal(v)
+	w.Header().Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+	w.Write(payload)
+}
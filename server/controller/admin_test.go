@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"bytes"
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestListUsers(t *testing.T) {
+	// arrange
+	var controller APIController
+	auth.RegisterClient("admin-listed", [32]byte{3})
+	wr := httptest.NewRecorder()
+	// act
+	controller.ListUsers(wr, httptest.NewRequest("GET", "/admin/users", nil))
+	// assert
+	var users []models.UserSummary
+	if err := json.Unmarshal(wr.Body.Bytes(), &users); err != nil {
+		t.Fatal("Unable to decode response:", err)
+	}
+
+	for _, user := range users {
+		if user.UserName == "admin-listed" && user.Fingerprint == auth.Fingerprint([32]byte{3}) {
+			return
+		}
+	}
+	t.Errorf("Registered user is not listed: %v", users)
+}
+
+func TestRevokeKey_NotFound(t *testing.T) {
+	// arrange
+	var controller APIController
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/admin/users/nobody/key", nil), map[string]string{"name": "nobody"})
+	wr := httptest.NewRecorder()
+	// act
+	controller.RevokeKey(wr, req)
+	// assert
+	if wr.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusNotFound, wr.Code)
+	}
+}
+
+func TestLogin_Banned(t *testing.T) {
+	table := []struct {
+		password string
+		code     int
+	}{
+		{"wrong-password", http.StatusUnauthorized},
+		{"quux-password", http.StatusForbidden},
+	}
+
+	var controller APIController
+	auth.Register("quux", "quux-password")
+	req := mux.SetURLVars(httptest.NewRequest("PUT", "/admin/users/quux/ban", nil), map[string]string{"name": "quux"})
+	controller.Ban(httptest.NewRecorder(), req)
+
+	for _, entry := range table {
+		// arrange
+		payload, _ := json.Marshal(models.LoginRequest{UserName: "quux", Password: entry.password, PublicKey: models.Key32{1}})
+		wr := httptest.NewRecorder()
+		// act
+		controller.Login(wr, httptest.NewRequest("POST", "/login", bytes.NewReader(payload)))
+		// assert
+		if wr.Code != entry.code {
+			t.Errorf("Unexpected status code for %[1]s. expected: %[2]v, actual %[3]v", entry.password, entry.code, wr.Code)
+		}
+	}
+}
+
+func TestIssueToken_UnknownScope(t *testing.T) {
+	// arrange
+	var controller APIController
+	payload := []byte("{\"userName\":\"operator\",\"scopes\":[\"root\"]}")
+	wr := httptest.NewRecorder()
+	// act
+	controller.IssueToken(wr, httptest.NewRequest("POST", "/admin/tokens", bytes.NewReader(payload)))
+	// assert
+	if wr.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusBadRequest, wr.Code)
+	}
+}
+
+func TestIssueToken_Impersonation(t *testing.T) {
+	admin := "admin-operator"
+	table := []struct {
+		authorization string
+		userName      string
+		code          int
+	}{
+		{"", "someone-else", http.StatusOK},
+		{"Bearer " + auth.CreateScopedToken(&admin, []string{auth.ScopeAdmin}), "someone-else", http.StatusForbidden},
+		{"Bearer " + auth.CreateScopedToken(&admin, []string{auth.ScopeAdmin}), admin, http.StatusOK},
+	}
+
+	var controller APIController
+	for _, entry := range table {
+		// arrange
+		payload, _ := json.Marshal(models.TokenRequest{UserName: entry.userName, Scopes: []string{auth.ScopeChatSend}})
+		req := httptest.NewRequest("POST", "/admin/tokens", bytes.NewReader(payload))
+		req.Header.Set(constants.HTTPAuthorization, entry.authorization)
+		wr := httptest.NewRecorder()
+		// act
+		controller.IssueToken(wr, req)
+		// assert
+		if wr.Code != entry.code {
+			t.Errorf("Unexpected status code for %[1]q. expected: %[2]v, actual %[3]v", entry.userName, entry.code, wr.Code)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/server/auth"
+	"ciphertalk/server/blobs"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// UploadBlob stores an encrypted file chunk under the sha256 hash of its content
+func (ctrl *APIController) UploadBlob(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	hash := mux.Vars(r)["hash"]
+
+	user, err := auth.ParseToken(r.Header.Get(constants.HTTPAuthorization))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !blobs.ValidHash(hash) {
+		http.Error(w, "Invalid request. Malformed blob hash", http.StatusBadRequest)
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if max := ctrl.blobs.MaxBlobSize(); max > 0 {
+		body = http.MaxBytesReader(w, r.Body, max)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "Blob is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	switch err = ctrl.blobs.Put(user.UserName, hash, data); err {
+	case nil:
+		w.WriteHeader(http.StatusCreated)
+	case blobs.ErrHashMismatch:
+		http.Error(w, "Invalid request. Blob content does not match its hash", http.StatusBadRequest)
+	case blobs.ErrTooLarge:
+		http.Error(w, "Blob is too large", http.StatusRequestEntityTooLarge)
+	case blobs.ErrStoreFull:
+		http.Error(w, "Blob store is full", http.StatusInsufficientStorage)
+	case blobs.ErrQuotaExceeded:
+		http.Error(w, "Blob quota exceeded", http.StatusInsufficientStorage)
+	default:
+		http.Error(w, "Unable to store blob", http.StatusInternalServerError)
+	}
+}
+
+// DownloadBlob returns an encrypted file chunk by its hash, otherwise returns 404
+func (ctrl *APIController) DownloadBlob(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+
+	data, err := ctrl.blobs.Get(hash)
+	if err != nil {
+		http.Error(w, "Blob "+hash+" not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(constants.HTTPContentType, constants.HTTPOctetStream)
+	w.Write(data)
+}
+
+// DeleteBlob removes an encrypted file chunk uploaded by the authenticated user
+func (ctrl *APIController) DeleteBlob(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+
+	user, err := auth.ParseToken(r.Header.Get(constants.HTTPAuthorization))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch err = ctrl.blobs.Delete(user.UserName, hash); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case blobs.ErrNotOwner:
+		http.Error(w, "Forbidden. Blob "+hash+" was uploaded by another user", http.StatusForbidden)
+	default:
+		http.Error(w, "Blob "+hash+" not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"bytes"
+	"ciphertalk/common/constants"
+	"ciphertalk/server/auth"
+	"ciphertalk/server/blobs"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// blobRequest returns a request for the blob with hash authenticated as userName
+func blobRequest(method string, userName string, hash string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, "/blobs", body)
+	req.Header.Set(constants.HTTPAuthorization, "Bearer "+auth.CreateToken(&userName))
+	return mux.SetURLVars(req, map[string]string{"hash": hash})
+}
+
+func TestUploadAndDownloadBlob(t *testing.T) {
+	// arrange
+	controller := APIController{blobs: blobs.NewStore(blobs.Limits{MaxBlobSize: 1024})}
+	data := []byte("sealed chunk")
+	hash := blobs.Hash(data)
+	upload := httptest.NewRecorder()
+	download := httptest.NewRecorder()
+	// act
+	controller.UploadBlob(upload, blobRequest("PUT", "blob-owner", hash, bytes.NewReader(data)))
+	controller.DownloadBlob(download, blobRequest("GET", "blob-reader", hash, nil))
+	// assert
+	if upload.Code != http.StatusCreated {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusCreated, upload.Code)
+	}
+
+	if download.Code != http.StatusOK || download.Body.String() != string(data) {
+		t.Errorf("Unexpected download. status: %v, body: %v", download.Code, download.Body.String())
+	}
+}
+
+func TestUploadBlob_BadRequest(t *testing.T) {
+	controller := APIController{blobs: blobs.NewStore(blobs.Limits{MaxBlobSize: 4})}
+	table := []struct {
+		hash string
+		data []byte
+		code int
+	}{
+		{"not-a-hash", []byte("abc"), http.StatusBadRequest},
+		{blobs.Hash([]byte("other")), []byte("abc"), http.StatusBadRequest},
+		{blobs.Hash([]byte("too long")), []byte("too long"), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, entry := range table {
+		// arrange
+		wr := httptest.NewRecorder()
+		req := blobRequest("PUT", "blob-owner", entry.hash, bytes.NewReader(entry.data))
+		// act
+		controller.UploadBlob(wr, req)
+		// assert
+		if wr.Code != entry.code {
+			t.Errorf("Unexpected status code. expected: %v, actual %v", entry.code, wr.Code)
+		}
+	}
+}
+
+func TestDownloadBlob_NotFound(t *testing.T) {
+	// arrange
+	controller := APIController{blobs: blobs.NewStore(blobs.Limits{})}
+	wr := httptest.NewRecorder()
+	req := blobRequest("GET", "blob-reader", blobs.Hash([]byte("missing")), nil)
+	// act
+	controller.DownloadBlob(wr, req)
+	// assert
+	if wr.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusNotFound, wr.Code)
+	}
+}
+
+func TestUploadBlob_QuotaExceeded(t *testing.T) {
+	// arrange
+	controller := APIController{blobs: blobs.NewStore(blobs.Limits{Quota: 16})}
+	first := []byte("first chunk")
+	second := []byte("second chunk")
+	controller.UploadBlob(httptest.NewRecorder(), blobRequest("PUT", "blob-owner", blobs.Hash(first), bytes.NewReader(first)))
+	wr := httptest.NewRecorder()
+	// act
+	controller.UploadBlob(wr, blobRequest("PUT", "blob-owner", blobs.Hash(second), bytes.NewReader(second)))
+	// assert
+	if wr.Code != http.StatusInsufficientStorage {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusInsufficientStorage, wr.Code)
+	}
+}
+
+func TestDeleteBlob(t *testing.T) {
+	data := []byte("sealed chunk")
+	hash := blobs.Hash(data)
+	table := []struct {
+		userName string
+		hash     string
+		code     int
+	}{
+		{"blob-reader", hash, http.StatusForbidden},
+		{"blob-owner", blobs.Hash([]byte("missing")), http.StatusNotFound},
+		{"blob-owner", hash, http.StatusNoContent},
+		{"blob-owner", hash, http.StatusNotFound},
+	}
+
+	controller := APIController{blobs: blobs.NewStore(blobs.Limits{})}
+	controller.UploadBlob(httptest.NewRecorder(), blobRequest("PUT", "blob-owner", hash, bytes.NewReader(data)))
+
+	for _, entry := range table {
+		// arrange
+		wr := httptest.NewRecorder()
+		// act
+		controller.DeleteBlob(wr, blobRequest("DELETE", entry.userName, entry.hash, nil))
+		// assert
+		if wr.Code != entry.code {
+			t.Errorf("Unexpected status code for %[1]s. expected: %[2]v, actual %[3]v", entry.userName, entry.code, wr.Code)
+		}
+	}
+}
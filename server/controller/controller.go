@@ -1,82 +1,275 @@
 package controller
 
 import (
+	"ciphertalk/common/codec"
 	"ciphertalk/common/constants"
 	"ciphertalk/common/models"
 	"ciphertalk/server/auth"
+	"ciphertalk/server/blobs"
+	"ciphertalk/server/logging"
+	"ciphertalk/server/metrics"
+	"ciphertalk/server/origin"
+	"ciphertalk/server/queue"
+	"ciphertalk/server/ratelimit"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// connection delivers frames to a client, it is a websocket, a server-sent events stream or a gRPC stream
+type connection interface {
+	WriteFrame(v interface{}) error
+	Close() error
+}
+
+// how long a websocket write may take before the client is considered gone, a stalled client must not block routing
+var socketWriteTimeout = 10 * time.Second
+
+// codecSocket is a websocket connection which encodes frames with the codec negotiated on upgrade
+type codecSocket struct {
+	*websocket.Conn
+	codec codec.Codec
+}
+
+// WriteFrame encodes v and sends it as a text or binary message depending on the codec
+func (s *codecSocket) WriteFrame(v interface{}) error {
+	data, err := s.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err = s.SetWriteDeadline(time.Now().Add(socketWriteTimeout)); err != nil {
+		return err
+	}
+	if s.codec.Binary() {
+		return s.WriteMessage(websocket.BinaryMessage, data)
+	}
+	return s.WriteMessage(websocket.TextMessage, data)
+}
+
+// ReadFrame reads the next message and decodes it into v
+func (s *codecSocket) ReadFrame(v interface{}) error {
+	_, data, err := s.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return s.codec.Unmarshal(data, v)
+}
+
 type client struct {
 	id     string
-	socket *websocket.Conn
+	connID string
+	socket connection
+	// remoteAddr and connectedAt are reported by the admin API
+	remoteAddr  string
+	connectedAt time.Time
+	logger      *slog.Logger
+	limiter     *ratelimit.Bucket
+	// signals such as typing indicators are limited separately from messages
+	signalLimiter *ratelimit.Bucket
+	// websocket connections support only one concurrent writer
+	writeMutex *sync.Mutex
+}
+
+// Config holds controller settings
+type Config struct {
+	// LoginLimit is applied per user name on /login to stop clients from repeatedly overwriting keys
+	LoginLimit ratelimit.Config
+	// MessageLimit is applied per websocket connection
+	MessageLimit ratelimit.Config
+	// SignalLimit is applied per websocket connection to ephemeral messages
+	SignalLimit ratelimit.Config
+	// Validation describes which messages are accepted from clients
+	Validation Validation
+	// MaxBlobSize is the largest encrypted file chunk in bytes accepted on upload
+	MaxBlobSize int64
+	// BlobCapacity is the total size in bytes of file chunks kept by the server
+	BlobCapacity int64
+	// BlobQuota is the total size in bytes of file chunks one user may keep on the server
+	BlobQuota int64
+	// BlobRetention is how long file chunks are kept after their upload
+	BlobRetention time.Duration
+	// QueueSize is the number of messages kept per offline recipient
+	QueueSize int
+	// QueueRetention is how long messages are kept for offline recipients
+	QueueRetention time.Duration
+	// AllowedOrigins lists browser origins which may open websockets from other sites
+	AllowedOrigins origin.AllowList
 }
 
+// how often expired messages and file chunks are purged
+const purgeInterval = time.Minute
+
 // APIController represents API controller
 type APIController struct {
 	clients  []client
 	mutex    sync.Mutex
 	upgrader websocket.Upgrader
 	channel  chan models.Message
+	logger   *slog.Logger
+	config   Config
+	logins   *ratelimit.Limiter
+	// messages sent over HTTP are limited per user because there is no connection to hold a bucket
+	httpMessages *ratelimit.Limiter
+	httpSignals  *ratelimit.Limiter
+	blobs        *blobs.Store
+	queue        *queue.Queue
+	// done is closed by Close to stop routing and purging
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // NewAPIController creates new instance of APIController
-func NewAPIController() *APIController {
+func NewAPIController(logger *slog.Logger, config Config) *APIController {
 	ctrl := new(APIController)
+	ctrl.logger = logger
+	ctrl.config = config
+	ctrl.logins = ratelimit.New(config.LoginLimit)
+	ctrl.httpMessages = ratelimit.New(config.MessageLimit)
+	ctrl.httpSignals = ratelimit.New(config.SignalLimit)
+	ctrl.blobs = blobs.NewStore(blobs.Limits{
+		MaxBlobSize: config.MaxBlobSize,
+		Capacity:    config.BlobCapacity,
+		Quota:       config.BlobQuota,
+		Retention:   config.BlobRetention,
+	})
+	ctrl.queue = queue.New(config.QueueSize, config.QueueRetention)
 
 	ctrl.upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		CheckOrigin:     config.AllowedOrigins.CheckOrigin,
+		// the token subprotocol offered by browsers is never echoed back, CBOR is preferred when a client offers it
+		Subprotocols: []string{constants.WebsocketProtocolCBOR, constants.WebsocketProtocol},
 	}
 
 	ctrl.channel = make(chan models.Message)
+	ctrl.done = make(chan struct{})
 
 	go ctrl.processMessages()
+	go ctrl.purgeExpired()
 
 	return ctrl
 }
 
+// Close stops routing messages and purging expired ones, messages accepted afterwards are rejected
+func (ctrl *APIController) Close() {
+	ctrl.closeOnce.Do(func() {
+		if ctrl.done != nil {
+			close(ctrl.done)
+		}
+	})
+}
+
 // HandleWebsockets saves incoming connections, reads messages and notifies message handler via a channel
 func (ctrl *APIController) HandleWebsockets(w http.ResponseWriter, r *http.Request) {
-	socket, err := ctrl.upgrader.Upgrade(w, r, nil)
+	logger := logging.FromContext(r.Context(), ctrl.logger)
+
+	conn, err := ctrl.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("websocket upgrade failed", "error", err)
+		return
 	}
+	socket := &codecSocket{Conn: conn, codec: codec.ForProtocol(conn.Subprotocol())}
 
 	authHeader := r.Header.Get(constants.HTTPAuthorization)
 	user, err := auth.ParseToken(authHeader)
 
 	if err != nil {
-		log.Fatal(err)
+		logger.Warn("unable to parse auth token", "error", err)
+		socket.Close()
+		return
 	}
 
-	cl := client{socket: socket, id: user.UserName}
-	ctrl.addClient(cl)
+	cl := ctrl.newClient(logger, socket, user.UserName, r.RemoteAddr)
+	queued := ctrl.addClient(cl)
+	cl.logger.Info("client connected", "transport", "websocket", "protocol", conn.Subprotocol())
+	ctrl.deliverQueued(cl, queued, socket.WriteFrame)
+
+	if ctrl.config.Validation.MaxFrameSize > 0 {
+		socket.SetReadLimit(ctrl.config.Validation.MaxFrameSize)
+	}
 
 	for {
 		var msg models.Message
 
-		err := socket.ReadJSON(&msg)
+		err := socket.ReadFrame(&msg)
 
 		if err != nil {
-			log.Printf("Unexpected error parsing message: %v", err)
+			cl.logger.Info("client disconnected", "error", err)
 			ctrl.removeClient(cl)
 			break
 		}
 
-		if !ctrl.isValid(&msg) {
-			ctrl.removeClient(cl)
-			break
+		if rej := ctrl.accept(cl.logger, cl.id, msg, cl.limiter.Allow, cl.signalLimiter.Allow); rej != nil && rej != signalsLimited {
+			cl.sendError(rej.reason, rej.code)
 		}
+	}
+}
+
+// accept rate limits and validates a message sent by an authenticated user and hands it over for delivery.
+// messages and signals report whether the sender is still within its rate limits. Invalid messages use up
+// tokens too, so probing for registered recipients is as limited as sending.
+func (ctrl *APIController) accept(logger *slog.Logger, userID string, msg models.Message, messages func() bool, signals func() bool) *rejection {
+	if msg.Ephemeral {
+		if !signals() {
+			logger.Debug("signal rate limit exceeded")
+			return signalsLimited
+		}
+	} else if !messages() {
+		logger.Warn("message rate limit exceeded")
+		metrics.MessagesDropped.Inc()
+		return &rejection{"Too many messages", http.StatusTooManyRequests}
+	}
+
+	if rej := ctrl.validate(userID, &msg); rej != nil {
+		logger.Warn("invalid message", "reason", rej.reason)
+		metrics.MessagesDropped.Inc()
+		return rej
+	}
+
+	logger.Debug("message received", "recipient", msg.RecipientID, "size", len(msg.Body), "sealed", msg.Sealed)
+	msg.Certificate = ""
+	return ctrl.enqueue(msg)
+}
+
+// enqueue hands a validated message over to processMessages unless the controller has been closed
+func (ctrl *APIController) enqueue(msg models.Message) *rejection {
+	closed := &rejection{"Server is shutting down", http.StatusServiceUnavailable}
+
+	// checked first, processMessages may still be receiving right after Close
+	select {
+	case <-ctrl.done:
+		return closed
+	default:
+	}
+
+	select {
+	case ctrl.channel <- msg:
+		return nil
+	case <-ctrl.done:
+		return closed
+	}
+}
 
-		// log.Printf("Recieved message from: %[1]v\n", msg.SenderID)
-		log.Printf("Verbose Logging\nRecieved message from: %[1]v\nSending to: %[2]v\nContent: %[3]v\n", msg.SenderID, msg.RecipientID, string(msg.Body[:len(msg.Body)]))
-		ctrl.channel <- msg
+func (ctrl *APIController) newClient(logger *slog.Logger, socket connection, userName string, remoteAddr string) client {
+	connID := logging.NewID()
+	return client{
+		socket:        socket,
+		id:            userName,
+		connID:        connID,
+		remoteAddr:    remoteAddr,
+		connectedAt:   time.Now(),
+		logger:        logger.With("conn_id", connID, "user", userName),
+		limiter:       ratelimit.NewBucket(ctrl.config.MessageLimit),
+		signalLimiter: ratelimit.NewBucket(ctrl.config.SignalLimit),
+		writeMutex:    new(sync.Mutex),
 	}
 }
 
@@ -87,103 +280,295 @@ func (ctrl *APIController) Login(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&loginReq)
 
 	if err != nil {
+		metrics.LoginAttempts.With("invalid_request").Inc()
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	if loginReq.UserName == "" {
-		http.Error(w, "Invalid request. Missing user name", http.StatusBadRequest)
+	response, rej := ctrl.login(loginReq)
+	if rej != nil {
+		if rej.code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(ctrl.config.LoginLimit.RetryAfter()))
+		}
+		http.Error(w, rej.reason, rej.code)
 		return
 	}
 
-	if len(loginReq.PublicKey) == 0 {
-		http.Error(w, "Invalid request. Missing public key", http.StatusBadRequest)
-		return
+	payload, _ := json.Marshal(response)
+	w.Header().Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+	w.Write([]byte(payload))
+}
+
+// login verifies credentials, registers the public key and issues a token, it is shared by HTTP and gRPC
+func (ctrl *APIController) login(loginReq models.LoginRequest) (models.LoginResponse, *rejection) {
+	if loginReq.UserName == "" {
+		metrics.LoginAttempts.With("invalid_request").Inc()
+		return models.LoginResponse{}, &rejection{"Invalid request. Missing user name", http.StatusBadRequest}
+	}
+
+	if loginReq.PublicKey == (models.Key32{}) {
+		metrics.LoginAttempts.With("invalid_request").Inc()
+		return models.LoginResponse{}, &rejection{"Invalid request. Missing public key", http.StatusBadRequest}
+	}
+
+	if !ctrl.logins.Allow(loginReq.UserName) {
+		metrics.LoginAttempts.With("rate_limited").Inc()
+		return models.LoginResponse{}, &rejection{"Too many login attempts", http.StatusTooManyRequests}
+	}
+
+	if err := auth.VerifyPassword(loginReq.UserName, loginReq.Password); err != nil {
+		metrics.LoginAttempts.With("invalid_credentials").Inc()
+		return models.LoginResponse{}, &rejection{"Invalid user name or password", http.StatusUnauthorized}
+	}
+
+	// checked after the password, so bans can not be probed without credentials
+	if auth.IsBanned(loginReq.UserName) {
+		metrics.LoginAttempts.With("banned").Inc()
+		return models.LoginResponse{}, &rejection{"User " + loginReq.UserName + " is banned", http.StatusForbidden}
 	}
 
 	response := models.LoginResponse{AuthToken: auth.CreateToken(&loginReq.UserName)}
-	payload, _ := json.Marshal(response)
 
 	// register client in our db
 	auth.RegisterClient(loginReq.UserName, loginReq.PublicKey)
+	metrics.LoginAttempts.With("success").Inc()
 
-	w.Header().Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
-	w.Write([]byte(payload))
+	return response, nil
 }
 
-// SecureChannel looks up client by user name and returns its public key if this client has been registered, otherwise return 404
-func (ctrl *APIController) SecureChannel(w http.ResponseWriter, r *http.Request) {
+// Register creates an account, the user name has to be unique
+func (ctrl *APIController) Register(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	var chReq = models.ChannelRequest{}
-	var err = json.NewDecoder(r.Body).Decode(&chReq)
+	var registerReq = models.RegisterRequest{}
+	err := json.NewDecoder(r.Body).Decode(&registerReq)
 
 	if err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	if chReq.UserName == "" {
-		http.Error(w, "Invalid request. Missing user name", http.StatusBadRequest)
+	if rej := ctrl.register(registerReq); rej != nil {
+		http.Error(w, rej.reason, rej.code)
 		return
 	}
 
-	var targetPubKey [32]byte
-	targetPubKey, err = auth.RetrieveClient(chReq.UserName)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (ctrl *APIController) register(registerReq models.RegisterRequest) *rejection {
+	err := auth.Register(registerReq.UserName, registerReq.Password)
+
+	switch err {
+	case nil:
+		return nil
+	case auth.ErrUserExists:
+		return &rejection{"User name " + registerReq.UserName + " is already taken", http.StatusConflict}
+	case auth.ErrInvalidUserName, auth.ErrWeakPassword:
+		return &rejection{"Invalid request. " + err.Error(), http.StatusBadRequest}
+	default:
+		ctrl.log().Error("unable to register account", "error", err)
+		return &rejection{"Unable to register account", http.StatusInternalServerError}
+	}
+}
+
+// SecureChannel looks up client by user name and returns its public key if this client has been registered, otherwise return 404
+func (ctrl *APIController) SecureChannel(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var chReq = models.ChannelRequest{}
+	var err = json.NewDecoder(r.Body).Decode(&chReq)
 
 	if err != nil {
-		http.Error(w, "Client "+chReq.UserName+" has not been registered", http.StatusNotFound)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	response, rej := ctrl.lookupKey(chReq)
+	if rej != nil {
+		http.Error(w, rej.reason, rej.code)
 		return
 	}
 
-	response := models.ChannelResponse{PublicKey: targetPubKey}
 	payload, _ := json.Marshal(response)
 	w.Header().Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
 	w.Write([]byte(payload))
 }
 
-func (ctrl *APIController) isValid(msg *models.Message) bool {
-	if msg.RecipientID == "" {
-		log.Printf("Invalid recepient")
-		return false
-	}
-
-	if msg.SenderID == "" {
-		log.Printf("Invalid sender")
-		return false
+func (ctrl *APIController) lookupKey(chReq models.ChannelRequest) (models.ChannelResponse, *rejection) {
+	if chReq.UserName == "" {
+		return models.ChannelResponse{}, &rejection{"Invalid request. Missing user name", http.StatusBadRequest}
 	}
 
-	if len(msg.Body) == 0 {
-		log.Printf("Invalid message body")
-		return false
+	targetPubKey, err := auth.RetrieveClient(chReq.UserName)
+	if err != nil {
+		return models.ChannelResponse{}, &rejection{"Client " + chReq.UserName + " has not been registered", http.StatusNotFound}
 	}
 
-	return true
+	return models.ChannelResponse{PublicKey: targetPubKey}, nil
 }
 
 // Sends incoming message to correct client
-// If recepient is offline, removes it from the list of clients
+// If recepient is offline, removes it from the list of clients and queues the message until it connects.
+// Ephemeral messages are only relayed to online recipients.
 func (ctrl *APIController) processMessages() {
 	for {
-		msg := <-ctrl.channel
+		var msg models.Message
+		select {
+		case msg = <-ctrl.channel:
+		case <-ctrl.done:
+			return
+		}
+
+		if msg.Retracts != "" && ctrl.queue.Remove(msg.RecipientID, msg.Retracts, msg.SenderID) {
+			metrics.MessagesRetracted.Inc()
+		}
+
+		delivered, queued := ctrl.route(msg)
+
+		if msg.Ephemeral {
+			if delivered {
+				metrics.SignalsRelayed.Inc()
+			}
+		} else if delivered {
+			metrics.MessagesRouted.Inc()
+		} else if queued {
+			metrics.MessagesQueued.Inc()
+			ctrl.log().Debug("recipient is offline, message queued", "recipient", msg.RecipientID)
+		} else {
+			metrics.MessagesDropped.Inc()
+			ctrl.log().Debug("recipient is offline and queue is full, message dropped", "recipient", msg.RecipientID)
+		}
+	}
+}
+
+// route writes the message to every connected client of its recipient. Messages for offline recipients are queued
+// while holding the clients mutex, so a client which connects meanwhile either receives them or pops them from the
+// queue in addClient.
+func (ctrl *APIController) route(msg models.Message) (delivered bool, queued bool) {
+	for {
+		var recipients []client
 
+		ctrl.mutex.Lock()
 		for _, cl := range ctrl.clients {
-
 			if cl.id == msg.RecipientID {
-				log.Printf("Sending message to: %[1]v\n", msg.RecipientID)
-				err := cl.socket.WriteJSON(msg)
+				recipients = append(recipients, cl)
+			}
+		}
 
-				if err != nil {
-					ctrl.removeClient(cl)
-				}
+		if len(recipients) == 0 {
+			if !msg.Ephemeral {
+				queued = ctrl.queue.Push(msg)
 			}
+			ctrl.mutex.Unlock()
+			return false, queued
+		}
+		ctrl.mutex.Unlock()
+
+		for _, cl := range recipients {
+			if err := cl.write(msg); err != nil {
+				cl.logger.Warn("unable to deliver message", "error", err)
+				ctrl.removeClient(cl)
+				continue
+			}
+
+			delivered = true
+			metrics.BytesRelayed.Add(uint64(len(msg.Body)))
+		}
+
+		// when every write failed the clients have been removed, so the message is queued on the next attempt
+		// unless the recipient has connected again
+		if delivered || msg.Ephemeral {
+			return delivered, false
+		}
+	}
+}
+
+// deliverQueued sends messages which arrived while the client was offline with write and unlocks the client's
+// writes. Messages which could not be written are queued again and the client is disconnected.
+func (ctrl *APIController) deliverQueued(cl client, queued []queue.Entry, write func(v interface{}) error) {
+	defer cl.writeMutex.Unlock()
+
+	for i, e := range queued {
+		msg := e.Message
+		if err := write(msg); err != nil {
+			cl.logger.Warn("unable to deliver queued message", "error", err, "requeued", len(queued)-i)
+			ctrl.mutex.Lock()
+			ctrl.queue.Requeue(cl.id, queued[i:])
+			ctrl.mutex.Unlock()
+			ctrl.removeClient(cl)
+			return
+		}
+
+		metrics.MessagesRouted.Inc()
+		metrics.BytesRelayed.Add(uint64(len(msg.Body)))
+	}
+}
+
+// purgeExpired periodically removes queued messages whose retention or TTL has passed and expired file chunks
+func (ctrl *APIController) purgeExpired() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctrl.done:
+			return
 		}
+
+		if purged := ctrl.queue.Purge(); purged > 0 {
+			metrics.MessagesExpired.Add(uint64(purged))
+			ctrl.log().Debug("expired queued messages purged", "count", purged)
+		}
+
+		if purged := ctrl.blobs.Purge(); purged > 0 {
+			ctrl.log().Debug("expired file chunks purged", "count", purged)
+		}
+	}
+}
+
+// sendError notifies client that its message has been rejected
+func (cl *client) sendError(reason string, code int) {
+	err := cl.write(models.ErrorFrame{Error: reason, Code: code})
+
+	if err != nil {
+		cl.logger.Warn("unable to send error frame", "error", err)
+	}
+}
+
+func (cl *client) write(v interface{}) error {
+	cl.writeMutex.Lock()
+	defer cl.writeMutex.Unlock()
+
+	return cl.socket.WriteFrame(v)
+}
+
+func (ctrl *APIController) log() *slog.Logger {
+	if ctrl.logger == nil {
+		return slog.Default()
 	}
+
+	return ctrl.logger
 }
 
-func (ctrl *APIController) addClient(c client) {
+func (ctrl *APIController) snapshotClients() []client {
+	ctrl.mutex.Lock()
+	defer ctrl.mutex.Unlock()
+
+	return append([]client(nil), ctrl.clients...)
+}
+
+// addClient registers the client and pops the messages queued while it was offline. The client's writes stay
+// locked until deliverQueued has sent them, so messages routed meanwhile are delivered after them.
+func (ctrl *APIController) addClient(c client) []queue.Entry {
+	c.writeMutex.Lock()
+
 	ctrl.mutex.Lock()
 	ctrl.clients = append(ctrl.clients, c)
+	queued := ctrl.queue.Pop(c.id)
 	ctrl.mutex.Unlock()
+
+	metrics.ActiveSockets.Inc()
+	return queued
 }
 
 func (ctrl *APIController) removeClient(c client) {
@@ -191,8 +576,10 @@ func (ctrl *APIController) removeClient(c client) {
 	c.socket.Close()
 
 	for i := range ctrl.clients {
-		if ctrl.clients[i].id == c.id {
+		if ctrl.clients[i].socket == c.socket {
 			ctrl.clients = append(ctrl.clients[:i], ctrl.clients[i+1:]...)
+			metrics.ActiveSockets.Dec()
+			break
 		}
 	}
 
@@ -2,12 +2,25 @@ package controller
 
 import (
 	"bytes"
+	"ciphertalk/common/codec"
+	"ciphertalk/common/constants"
 	"ciphertalk/common/models"
 	"ciphertalk/server/auth"
+	"ciphertalk/server/metrics"
+	"ciphertalk/server/queue"
+	"ciphertalk/server/ratelimit"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 type MockResponseWriter struct {
@@ -27,13 +40,14 @@ func (mrw MockResponseWriter) WriteHeader(code int) {
 
 func TestLogin(t *testing.T) {
 	// arrange
-	var userKey [32]byte
+	userKey := models.Key32{1}
 	var controller APIController
 	var responseWriter MockResponseWriter
 	responseWriter.header = make(map[string][]string)
 
 	user := "foo@bar.com"
-	loginReq := models.LoginRequest{UserName: user, PublicKey: userKey}
+	auth.Register(user, "password")
+	loginReq := models.LoginRequest{UserName: user, Password: "password", PublicKey: userKey}
 	payload, _ := json.Marshal(loginReq)
 	httpRequest := httptest.NewRequest("GET", "/login", bytes.NewReader(payload))
 
@@ -46,9 +60,92 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+func TestLogin_CountsAttempts(t *testing.T) {
+	// arrange
+	var controller APIController
+	auth.Register("baz", "password")
+	before := metrics.LoginAttempts.With("success").Value()
+	payload, _ := json.Marshal(models.LoginRequest{UserName: "baz", Password: "password", PublicKey: models.Key32{1}})
+	req := httptest.NewRequest("POST", "/login", bytes.NewReader(payload))
+	// act
+	controller.Login(httptest.NewRecorder(), req)
+	// assert
+	if metrics.LoginAttempts.With("success").Value() != before+1 {
+		t.Error("Successful login was not counted")
+	}
+}
+
+func TestLogin_RateLimited(t *testing.T) {
+	// arrange
+	controller := APIController{logins: ratelimit.New(ratelimit.Config{Rate: 0.001, Burst: 1})}
+	auth.Register("qux", "password")
+	payload, _ := json.Marshal(models.LoginRequest{UserName: "qux", Password: "password", PublicKey: models.Key32{1}})
+	codes := []int{}
+	// act
+	for i := 0; i < 2; i++ {
+		wr := httptest.NewRecorder()
+		controller.Login(wr, httptest.NewRequest("POST", "/login", bytes.NewReader(payload)))
+		codes = append(codes, wr.Code)
+	}
+	// assert
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("Unexpected status codes: %v", codes)
+	}
+}
+
+func TestLogin_InvalidCredentials(t *testing.T) {
+	// arrange
+	var controller APIController
+	auth.Register("quuz", "password")
+	var credentialsTable = []models.LoginRequest{
+		{UserName: "quuz", Password: "wrong-password", PublicKey: models.Key32{1}},
+		{UserName: "quuz", PublicKey: models.Key32{1}},
+		{UserName: "unregistered", Password: "password", PublicKey: models.Key32{1}},
+	}
+
+	for _, entry := range credentialsTable {
+		wr := httptest.NewRecorder()
+		payload, _ := json.Marshal(entry)
+		// act
+		controller.Login(wr, httptest.NewRequest("POST", "/login", bytes.NewReader(payload)))
+		// assert
+		if wr.Code != http.StatusUnauthorized {
+			t.Errorf("Unexpected status code for %v. expected: %v, actual %v", string(payload), http.StatusUnauthorized, wr.Code)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var registerTable = []struct {
+		body     string
+		expected int
+	}{
+		{"{\"userName\":\"corge\",\"password\":\"password\"}", http.StatusCreated},
+		{"{\"userName\":\"corge\",\"password\":\"password\"}", http.StatusConflict},
+		{"{\"userName\":\"grault\",\"password\":\"short\"}", http.StatusBadRequest},
+		{"{\"userName\":\"no spaces\",\"password\":\"password\"}", http.StatusBadRequest},
+		{"{\"userName\":\"ab\",\"password\":\"password\"}", http.StatusBadRequest},
+		{"{", http.StatusBadRequest},
+	}
+
+	for _, entry := range registerTable {
+		// arrange
+		var controller APIController
+		wr := httptest.NewRecorder()
+		// act
+		controller.Register(wr, httptest.NewRequest("POST", "/register", bytes.NewReader([]byte(entry.body))))
+		// assert
+		if wr.Code != entry.expected {
+			t.Errorf("Unexpected status code for %v. expected: %v, actual %v", entry.body, entry.expected, wr.Code)
+		}
+	}
+}
+
 func TestLogin_BadRequest(t *testing.T) {
 	var invalidLoginTable [][]byte
-	body, _ := json.Marshal(models.LoginRequest{UserName: "", PublicKey: [32]byte{}})
+	body, _ := json.Marshal(models.LoginRequest{UserName: "", PublicKey: models.Key32{1}})
+	invalidLoginTable = append(invalidLoginTable, body)
+	body, _ = json.Marshal(models.LoginRequest{UserName: "quuz", Password: "password"})
 	invalidLoginTable = append(invalidLoginTable, body)
 	body = make([]byte, 1)
 	invalidLoginTable = append(invalidLoginTable, body)
@@ -114,3 +211,253 @@ func TestSecureChannel(t *testing.T) {
 		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusOK, wr.Code)
 	}
 }
+
+func TestHandleWebsockets_Codecs(t *testing.T) {
+	var codecTable = []struct {
+		protocols   []string
+		frameType   int
+		frameCodec  codec.Codec
+		negotiation string
+	}{
+		{nil, websocket.TextMessage, codec.JSON, ""},
+		{[]string{constants.WebsocketProtocol}, websocket.TextMessage, codec.JSON, constants.WebsocketProtocol},
+		{[]string{constants.WebsocketProtocolCBOR, constants.WebsocketProtocol}, websocket.BinaryMessage, codec.CBOR, constants.WebsocketProtocolCBOR},
+	}
+
+	controller := NewAPIController(slog.Default(), Config{})
+	server := httptest.NewServer(http.HandlerFunc(controller.HandleWebsockets))
+	defer server.Close()
+
+	for _, entry := range codecTable {
+		// arrange
+		user := "codec-" + entry.negotiation
+		auth.RegisterClient(user, [32]byte{})
+		dialer := websocket.Dialer{Subprotocols: entry.protocols}
+		headers := http.Header{constants.HTTPAuthorization: {"Bearer " + auth.CreateToken(&user)}}
+
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), headers)
+		if err != nil {
+			t.Fatal("Unable to connect:", err)
+		}
+
+		// act
+		msg := models.Message{SenderID: user, RecipientID: user, Body: []byte("secret"), TimeStamp: time.Now().Format(constants.TimeStampFormat)}
+		data, _ := entry.frameCodec.Marshal(msg)
+		conn.WriteMessage(entry.frameType, data)
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		frameType, frame, err := conn.ReadMessage()
+		conn.Close()
+
+		// assert
+		if conn.Subprotocol() != entry.negotiation {
+			t.Errorf("Expected subprotocol %q, got %q", entry.negotiation, conn.Subprotocol())
+		}
+
+		var received models.Message
+		if err != nil || frameType != entry.frameType || entry.frameCodec.Unmarshal(frame, &received) != nil || string(received.Body) != "secret" {
+			t.Errorf("Expected message echoed as frame type %v for %v, got type %v %q %v", entry.frameType, entry.protocols, frameType, frame, err)
+		}
+	}
+}
+
+func TestHandleWebsockets_InvalidFramesLimited(t *testing.T) {
+	// arrange
+	controller := NewAPIController(slog.Default(), Config{MessageLimit: ratelimit.Config{Rate: 0.001, Burst: 3}})
+	server := httptest.NewServer(http.HandlerFunc(controller.HandleWebsockets))
+	defer server.Close()
+
+	user := "prober@bar.com"
+	auth.RegisterClient(user, [32]byte{})
+	headers := http.Header{constants.HTTPAuthorization: {"Bearer " + auth.CreateToken(&user)}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), headers)
+	if err != nil {
+		t.Fatal("Unable to connect:", err)
+	}
+	defer conn.Close()
+
+	var codes []int
+	for i := 0; i < 6; i++ {
+		// act
+		conn.WriteJSON(models.Message{SenderID: user, RecipientID: "nobody-" + strconv.Itoa(i), Body: []byte("secret"), TimeStamp: time.Now().Format(constants.TimeStampFormat)})
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var frame models.ErrorFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatal("Unable to read error frame:", err)
+		}
+		codes = append(codes, frame.Code)
+	}
+
+	// assert
+	expected := []int{http.StatusNotFound, http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	if !reflect.DeepEqual(codes, expected) {
+		t.Errorf("Unexpected error frames. expected: %v, actual: %v", expected, codes)
+	}
+}
+
+// failingConnection accepts a number of frames and fails afterwards
+type failingConnection struct {
+	frames []interface{}
+	accept int
+}
+
+func (c *failingConnection) WriteFrame(v interface{}) error {
+	if len(c.frames) == c.accept {
+		return errStreamFull
+	}
+	c.frames = append(c.frames, v)
+	return nil
+}
+
+func (c *failingConnection) Close() error {
+	return nil
+}
+
+func TestDeliverQueued_RequeuesOnWriteError(t *testing.T) {
+	// arrange
+	controller := APIController{queue: queue.New(0, 0)}
+	for i := 0; i < 3; i++ {
+		controller.queue.Push(models.Message{RecipientID: "queued-bob", Body: []byte(strconv.Itoa(i))})
+	}
+	conn := &failingConnection{accept: 1}
+	cl := controller.newClient(slog.Default(), conn, "queued-bob", "")
+	// act
+	controller.deliverQueued(cl, controller.addClient(cl), conn.WriteFrame)
+	// assert
+	if len(conn.frames) != 1 {
+		t.Errorf("Unexpected frames: %v", conn.frames)
+	}
+
+	requeued := controller.queue.Pop("queued-bob")
+	if len(requeued) != 2 || string(requeued[0].Message.Body) != "1" || string(requeued[1].Message.Body) != "2" {
+		t.Errorf("Unexpected requeued messages: %v", requeued)
+	}
+
+	if len(controller.snapshotClients()) != 0 {
+		t.Error("Client should be removed after a failed write")
+	}
+}
+
+func TestRoute_QueuedBeforeNewMessages(t *testing.T) {
+	// arrange
+	controller := APIController{queue: queue.New(0, 0)}
+	controller.queue.Push(models.Message{RecipientID: "ordered-bob", Body: []byte("queued")})
+	conn := &failingConnection{accept: 10}
+	cl := controller.newClient(slog.Default(), conn, "ordered-bob", "")
+	queued := controller.addClient(cl)
+	routed := make(chan bool)
+	// act
+	go func() {
+		delivered, _ := controller.route(models.Message{RecipientID: "ordered-bob", Body: []byte("routed")})
+		routed <- delivered
+	}()
+	controller.deliverQueued(cl, queued, conn.WriteFrame)
+	// assert
+	if !<-routed {
+		t.Fatal("Message for the connected client should be delivered")
+	}
+
+	if len(conn.frames) != 2 || string(conn.frames[0].(models.Message).Body) != "queued" {
+		t.Errorf("Queued message should be delivered first: %v", conn.frames)
+	}
+}
+
+func TestHandleWebsockets_EphemeralNotQueued(t *testing.T) {
+	// arrange
+	controller := NewAPIController(slog.Default(), Config{QueueSize: 10})
+	server := httptest.NewServer(http.HandlerFunc(controller.HandleWebsockets))
+	defer server.Close()
+
+	user := "ephemeral-alice"
+	recipient := "ephemeral-bob"
+	auth.RegisterClient(user, [32]byte{})
+	auth.RegisterClient(recipient, [32]byte{})
+	headers := http.Header{constants.HTTPAuthorization: {"Bearer " + auth.CreateToken(&user)}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), headers)
+	if err != nil {
+		t.Fatal("Unable to connect:", err)
+	}
+	defer conn.Close()
+
+	// act
+	timeStamp := time.Now().Format(constants.TimeStampFormat)
+	conn.WriteJSON(models.Message{SenderID: user, RecipientID: recipient, Body: []byte("typing"), TimeStamp: timeStamp, Ephemeral: true})
+	conn.WriteJSON(models.Message{SenderID: user, RecipientID: recipient, Body: []byte("secret"), TimeStamp: timeStamp})
+
+	// messages are routed in order, so the signal has been handled once the message is queued
+	for i := 0; i < 100 && controller.queue.Len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// assert
+	queued := controller.queue.Pop(recipient)
+	if len(queued) != 1 || string(queued[0].Message.Body) != "secret" {
+		t.Errorf("Only the message should be queued for the offline recipient: %v", queued)
+	}
+}
+
+func TestHandleWebsockets_SignalLimit(t *testing.T) {
+	// arrange
+	controller := NewAPIController(slog.Default(), Config{
+		MessageLimit: ratelimit.Config{Rate: 0.001, Burst: 1},
+		SignalLimit:  ratelimit.Config{Rate: 0.001, Burst: 2},
+	})
+	server := httptest.NewServer(http.HandlerFunc(controller.HandleWebsockets))
+	defer server.Close()
+
+	user := "signal-alice"
+	auth.RegisterClient(user, [32]byte{})
+	headers := http.Header{constants.HTTPAuthorization: {"Bearer " + auth.CreateToken(&user)}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), headers)
+	if err != nil {
+		t.Fatal("Unable to connect:", err)
+	}
+	defer conn.Close()
+
+	// act
+	timeStamp := time.Now().Format(constants.TimeStampFormat)
+	for i := 0; i < 3; i++ {
+		conn.WriteJSON(models.Message{SenderID: user, RecipientID: user, Body: []byte("typing"), TimeStamp: timeStamp, Ephemeral: true})
+	}
+	for i := 0; i < 2; i++ {
+		conn.WriteJSON(models.Message{SenderID: user, RecipientID: user, Body: []byte("secret"), TimeStamp: timeStamp})
+	}
+
+	var frames []string
+	for i := 0; i < 4; i++ {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal("Unable to read frame:", err)
+		}
+
+		var frame struct {
+			models.Message
+			models.ErrorFrame
+		}
+		json.Unmarshal(data, &frame)
+		frames = append(frames, string(frame.Body)+strconv.Itoa(frame.Code))
+	}
+
+	// assert
+	// the third signal is dropped silently and does not use up the message budget. Error frames are written by
+	// the connection while messages are routed, so their order is not fixed.
+	sort.Strings(frames)
+	expected := []string{"429", "secret0", "typing0", "typing0"}
+	if !reflect.DeepEqual(frames, expected) {
+		t.Errorf("Unexpected frames. expected: %v, actual: %v", expected, frames)
+	}
+}
+
+func TestClose_RejectsMessages(t *testing.T) {
+	// arrange
+	controller := NewAPIController(slog.Default(), Config{})
+	// act
+	controller.Close()
+	rej := controller.enqueue(models.Message{RecipientID: "closed-bob", Body: []byte("secret")})
+	// assert
+	if rej == nil || rej.code != http.StatusServiceUnavailable {
+		t.Errorf("Message was accepted after the controller was closed: %v", rej)
+	}
+}
@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"ciphertalk/common/models"
+	"ciphertalk/common/pb"
+	"ciphertalk/server/auth"
+	"ciphertalk/server/metrics"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcScopes lists the scopes gRPC methods require, Register and Login are called before a token exists
+var grpcScopes = auth.GRPCScopes{
+	pb.Ciphertalk_GetPublicKey_FullMethodName: auth.ScopeDirectoryRead,
+	pb.Ciphertalk_Chat_FullMethodName:         auth.ScopeChatSend,
+}
+
+// grpcService implements the gRPC API on top of the controller, messages are routed with websocket and HTTP messages
+type grpcService struct {
+	pb.UnimplementedCiphertalkServer
+	ctrl *APIController
+}
+
+// NewGRPCServer creates a gRPC server which serves the Ciphertalk service of the controller
+func (ctrl *APIController) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.MaxRecvMsgSize(int(ctrl.maxFrameSize())),
+		grpc.ChainUnaryInterceptor(grpcScopes.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(grpcScopes.StreamInterceptor()),
+	)
+
+	srv := grpc.NewServer(opts...)
+	pb.RegisterCiphertalkServer(srv, &grpcService{ctrl: ctrl})
+	return srv
+}
+
+// Register creates an account
+func (s *grpcService) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	if rej := s.ctrl.register(models.RegisterRequest{UserName: req.UserName, Password: req.Password}); rej != nil {
+		return nil, rej.grpcStatus()
+	}
+
+	return &pb.RegisterResponse{}, nil
+}
+
+// Login verifies the password, stores the public key and issues an auth token
+func (s *grpcService) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	loginReq := models.LoginRequest{UserName: req.UserName, Password: req.Password}
+	if len(req.PublicKey) != len(loginReq.PublicKey) {
+		metrics.LoginAttempts.With("invalid_request").Inc()
+		return nil, status.Error(codes.InvalidArgument, "Invalid request. Public key must be 32 bytes")
+	}
+	copy(loginReq.PublicKey[:], req.PublicKey)
+
+	response, rej := s.ctrl.login(loginReq)
+	if rej != nil {
+		return nil, rej.grpcStatus()
+	}
+
+	return &pb.LoginResponse{AuthToken: response.AuthToken}, nil
+}
+
+// GetPublicKey returns the public key of a registered user
+func (s *grpcService) GetPublicKey(ctx context.Context, req *pb.ChannelRequest) (*pb.ChannelResponse, error) {
+	response, rej := s.ctrl.lookupKey(models.ChannelRequest{UserName: req.UserName})
+	if rej != nil {
+		return nil, rej.grpcStatus()
+	}
+
+	return &pb.ChannelResponse{PublicKey: response.PublicKey[:]}, nil
+}
+
+// Chat registers the caller as a connected client. Messages received on the stream are validated and routed
+// like websocket messages, delivered messages and rejections are sent back as chat frames.
+func (s *grpcService) Chat(stream pb.Ciphertalk_ChatServer) error {
+	user, ok := auth.ProfileFromContext(stream.Context())
+	if !ok {
+		return status.Error(codes.Unauthenticated, "Missing bearer token in authorization metadata")
+	}
+
+	remoteAddr := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	conn := newChatStream()
+	cl := s.ctrl.newClient(s.ctrl.log(), conn, user.UserName, remoteAddr)
+	queued := s.ctrl.addClient(cl)
+	cl.logger.Info("client connected", "transport", "grpc")
+
+	// queued messages are sent directly, they could fill the stream buffer before the loop below drains it
+	s.ctrl.deliverQueued(cl, queued, func(v interface{}) error {
+		frame, err := chatFrame(v)
+		if err == nil {
+			err = stream.Send(frame)
+		}
+		return err
+	})
+
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				cl.logger.Info("client disconnected", "error", err)
+				conn.Close()
+				return
+			}
+
+			msg, rej := messageFromProto(in)
+			if rej == nil {
+				rej = s.ctrl.accept(cl.logger, cl.id, msg, cl.limiter.Allow, cl.signalLimiter.Allow)
+			}
+
+			if rej != nil && rej != signalsLimited {
+				cl.sendError(rej.reason, rej.code)
+			}
+		}
+	}()
+
+	// only this goroutine sends on the stream, a slow client fills its own buffer instead of blocking routing
+	var err error
+	for err == nil {
+		select {
+		case frame := <-conn.frames:
+			err = stream.Send(frame)
+		case <-conn.done:
+			err = errStreamClosed
+		case <-stream.Context().Done():
+			err = stream.Context().Err()
+		}
+	}
+
+	s.ctrl.removeClient(cl)
+	conn.Close()
+	return nil
+}
+
+// chatStream is a connection which queues frames for a gRPC Chat stream, the Chat handler sends them
+type chatStream struct {
+	frames chan *pb.ChatFrame
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newChatStream() *chatStream {
+	return &chatStream{frames: make(chan *pb.ChatFrame, streamBufferSize), done: make(chan struct{})}
+}
+
+// WriteFrame queues a message or an error frame, it never blocks the routing loop
+func (c *chatStream) WriteFrame(v interface{}) error {
+	frame, err := chatFrame(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.done:
+		return errStreamClosed
+	case c.frames <- frame:
+		return nil
+	default:
+		return errStreamFull
+	}
+}
+
+// Close ends the Chat call
+func (c *chatStream) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+func chatFrame(v interface{}) (*pb.ChatFrame, error) {
+	switch v := v.(type) {
+	case models.Message:
+		return &pb.ChatFrame{Frame: &pb.ChatFrame_Message{Message: messageToProto(v)}}, nil
+	case models.ErrorFrame:
+		return &pb.ChatFrame{Frame: &pb.ChatFrame_Error{Error: &pb.ErrorFrame{Error: v.Error, Code: int32(v.Code)}}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported frame %T", v)
+	}
+}
+
+func messageFromProto(in *pb.Message) (models.Message, *rejection) {
+	msg := models.Message{
+		ID:          in.Id,
+		SenderID:    in.SenderId,
+		RecipientID: in.RecipientId,
+		Body:        in.Body,
+		TimeStamp:   in.TimeStamp,
+		Sealed:      in.Sealed,
+		Certificate: in.Certificate,
+		TTL:         in.Ttl,
+		Ephemeral:   in.Ephemeral,
+		Retracts:    in.Retracts,
+	}
+
+	// an empty nonce is the zero nonce JSON clients send with sealed messages
+	if len(in.MsgNonce) != 0 && len(in.MsgNonce) != len(msg.MsgNonce) {
+		return msg, &rejection{"Nonce must be 24 bytes", http.StatusBadRequest}
+	}
+	copy(msg.MsgNonce[:], in.MsgNonce)
+
+	return msg, nil
+}
+
+func messageToProto(msg models.Message) *pb.Message {
+	return &pb.Message{
+		Id:          msg.ID,
+		SenderId:    msg.SenderID,
+		RecipientId: msg.RecipientID,
+		Body:        msg.Body,
+		TimeStamp:   msg.TimeStamp,
+		MsgNonce:    msg.MsgNonce[:],
+		Sealed:      msg.Sealed,
+		Certificate: msg.Certificate,
+		Ttl:         msg.TTL,
+		Ephemeral:   msg.Ephemeral,
+		Retracts:    msg.Retracts,
+	}
+}
+
+// grpcStatus maps the HTTP status of a rejection to the closest gRPC code
+func (rej *rejection) grpcStatus() error {
+	code := codes.Unknown
+
+	switch rej.code {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusInternalServerError:
+		code = codes.Internal
+	}
+
+	return status.Error(code, rej.reason)
+}
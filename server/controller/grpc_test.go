@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/common/pb"
+	"ciphertalk/server/auth"
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialGRPC serves the controller's gRPC API over an in-memory listener and returns a connected client
+func dialGRPC(t *testing.T, controller *APIController) pb.CiphertalkClient {
+	listener := bufconn.Listen(1024 * 1024)
+	srv := controller.NewGRPCServer()
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal("Unable to dial gRPC server:", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewCiphertalkClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPC_LoginAndGetPublicKey(t *testing.T) {
+	// arrange
+	client := dialGRPC(t, NewAPIController(slog.Default(), Config{}))
+	key := make([]byte, 32)
+	key[0] = 42
+
+	_, err := client.Register(context.Background(), &pb.RegisterRequest{UserName: "grpc-alice", Password: "password"})
+	if err != nil {
+		t.Fatal("Unable to register:", err)
+	}
+
+	// act
+	login, err := client.Login(context.Background(), &pb.LoginRequest{UserName: "grpc-alice", Password: "password", PublicKey: key})
+	if err != nil {
+		t.Fatal("Unable to login:", err)
+	}
+	res, err := client.GetPublicKey(withToken(login.AuthToken), &pb.ChannelRequest{UserName: "grpc-alice"})
+
+	// assert
+	if err != nil {
+		t.Fatal("Unable to get public key:", err)
+	}
+	if res.PublicKey[0] != 42 || len(res.PublicKey) != 32 {
+		t.Errorf("Expected the key sent on login, got %v", res.PublicKey)
+	}
+}
+
+func TestGRPC_Errors(t *testing.T) {
+	// arrange
+	client := dialGRPC(t, NewAPIController(slog.Default(), Config{}))
+	auth.Register("grpc-bob", "password")
+	user := "grpc-bob"
+	chatOnly := auth.CreateScopedToken(&user, []string{auth.ScopeChatSend})
+	key := make([]byte, 32)
+	key[0] = 1
+
+	var tests = []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"duplicate account", func() error {
+			_, err := client.Register(context.Background(), &pb.RegisterRequest{UserName: "grpc-bob", Password: "password"})
+			return err
+		}, codes.AlreadyExists},
+		{"short public key", func() error {
+			_, err := client.Login(context.Background(), &pb.LoginRequest{UserName: "grpc-bob", Password: "password", PublicKey: []byte{1}})
+			return err
+		}, codes.InvalidArgument},
+		{"missing public key", func() error {
+			_, err := client.Login(context.Background(), &pb.LoginRequest{UserName: "grpc-bob", Password: "password", PublicKey: make([]byte, 32)})
+			return err
+		}, codes.InvalidArgument},
+		{"wrong password", func() error {
+			_, err := client.Login(context.Background(), &pb.LoginRequest{UserName: "grpc-bob", Password: "wrong-password", PublicKey: key})
+			return err
+		}, codes.Unauthenticated},
+		{"missing token", func() error {
+			_, err := client.GetPublicKey(context.Background(), &pb.ChannelRequest{UserName: "grpc-bob"})
+			return err
+		}, codes.Unauthenticated},
+		{"missing scope", func() error {
+			_, err := client.GetPublicKey(withToken(chatOnly), &pb.ChannelRequest{UserName: "grpc-bob"})
+			return err
+		}, codes.PermissionDenied},
+		{"unknown user", func() error {
+			_, err := client.GetPublicKey(withToken(auth.CreateToken(&user)), &pb.ChannelRequest{UserName: "grpc-nobody"})
+			return err
+		}, codes.NotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			err := test.call()
+
+			// assert
+			if status.Code(err) != test.code {
+				t.Errorf("Expected %v, got %v", test.code, err)
+			}
+		})
+	}
+}
+
+func TestGRPC_Chat(t *testing.T) {
+	// arrange
+	controller := NewAPIController(slog.Default(), Config{})
+	client := dialGRPC(t, controller)
+	sender, recipient := "grpc-carol", "grpc-dave"
+	auth.RegisterClient(sender, [32]byte{})
+	auth.RegisterClient(recipient, [32]byte{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receiving, err := client.Chat(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+auth.CreateToken(&recipient)))
+	if err != nil {
+		t.Fatal("Unable to open chat:", err)
+	}
+	sending, err := client.Chat(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+auth.CreateToken(&sender)))
+	if err != nil {
+		t.Fatal("Unable to open chat:", err)
+	}
+
+	for i := 0; i < 100 && len(controller.snapshotClients()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// act
+	sending.Send(&pb.Message{SenderId: sender, RecipientId: recipient, Body: []byte("secret"), MsgNonce: make([]byte, 24), TimeStamp: time.Now().Format(constants.TimeStampFormat)})
+	sending.Send(&pb.Message{SenderId: sender, RecipientId: recipient, Body: []byte("secret"), MsgNonce: []byte{1}, TimeStamp: time.Now().Format(constants.TimeStampFormat)})
+	delivered, deliverErr := receiving.Recv()
+	rejected, rejectErr := sending.Recv()
+
+	// assert
+	if deliverErr != nil || string(delivered.GetMessage().GetBody()) != "secret" || delivered.GetMessage().GetSenderId() != sender {
+		t.Errorf("Expected message from %v, got %v %v", sender, delivered, deliverErr)
+	}
+	if rejectErr != nil || rejected.GetError().GetCode() != 400 {
+		t.Errorf("Expected error frame for invalid nonce, got %v %v", rejected, rejectErr)
+	}
+}
+
+func TestGRPC_ChatRequiresToken(t *testing.T) {
+	// arrange
+	client := dialGRPC(t, NewAPIController(slog.Default(), Config{}))
+
+	// act
+	stream, err := client.Chat(context.Background())
+	if err == nil {
+		_, err = stream.Recv()
+	}
+
+	// assert
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+}
+
+func TestChatStream_FullBuffer(t *testing.T) {
+	// arrange
+	c := newChatStream()
+	// act
+	var err error
+	for i := 0; i <= streamBufferSize && err == nil; i++ {
+		err = c.WriteFrame(models.ErrorFrame{Error: "frame", Code: i})
+	}
+	// assert
+	if err != errStreamFull {
+		t.Errorf("Expected full buffer error, got: %v", err)
+	}
+
+	c.Close()
+	if c.WriteFrame(models.ErrorFrame{}) != errStreamClosed {
+		t.Error("Closed stream accepted a frame")
+	}
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"ciphertalk/server/logging"
+	"ciphertalk/server/metrics"
+	"encoding/json"
+	"net/http"
+)
+
+// DeliveryCertificate issues a short-lived certificate which authorizes sending sealed sender messages
+func (ctrl *APIController) DeliveryCertificate(w http.ResponseWriter, r *http.Request) {
+	certificate, expires := auth.CreateDeliveryCertificate()
+
+	response := models.DeliveryCertificateResponse{Certificate: certificate, Expires: expires.Unix()}
+	payload, _ := json.Marshal(response)
+	w.Header().Set(constants.HTTPContentType, constants.HTTPApplicationJSON)
+	w.Write([]byte(payload))
+}
+
+// SendSealed accepts a sealed sender message without authenticating the sender and routes it to the recipient.
+// Delivery is authorized by the certificate attached to the message, so the server only learns the recipient.
+func (ctrl *APIController) SendSealed(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var msg models.Message
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, ctrl.maxFrameSize())).Decode(&msg)
+
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if !msg.Sealed {
+		http.Error(w, "Invalid request. Message is not sealed", http.StatusBadRequest)
+		return
+	}
+
+	if rej := ctrl.validate("", &msg); rej != nil {
+		metrics.MessagesDropped.Inc()
+		http.Error(w, rej.reason, rej.code)
+		return
+	}
+
+	logging.FromContext(r.Context(), ctrl.logger).Debug("sealed message received", "recipient", msg.RecipientID, "size", len(msg.Body))
+	msg.Certificate = ""
+	if rej := ctrl.enqueue(msg); rej != nil {
+		http.Error(w, rej.reason, rej.code)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"bytes"
+	"ciphertalk/common/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendSealed_TooLarge(t *testing.T) {
+	// arrange
+	controller := APIController{config: Config{Validation: Validation{MaxFrameSize: 256}}}
+	msg := models.Message{RecipientID: "sealed-bob", Body: bytes.Repeat([]byte("x"), 1024), Sealed: true}
+	payload, _ := json.Marshal(msg)
+	wr := httptest.NewRecorder()
+	// act
+	controller.SendSealed(wr, httptest.NewRequest("POST", "/sealed", bytes.NewReader(payload)))
+	// assert
+	if wr.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusBadRequest, wr.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"ciphertalk/server/logging"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// number of frames buffered for a stream before the client is considered too slow and disconnected
+const streamBufferSize = 64
+
+// how often a comment is sent on idle streams so proxies do not close them
+var streamKeepAlive = 25 * time.Second
+
+var errStreamClosed = errors.New("stream is closed")
+var errStreamFull = errors.New("stream buffer is full")
+
+// stream is a connection which delivers frames as server-sent events, for networks which block websockets
+type stream struct {
+	frames chan []byte
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newStream() *stream {
+	return &stream{frames: make(chan []byte, streamBufferSize), done: make(chan struct{})}
+}
+
+// WriteFrame queues a JSON frame for the stream, it never blocks the routing loop
+func (s *stream) WriteFrame(v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-s.done:
+		return errStreamClosed
+	case s.frames <- payload:
+		return nil
+	default:
+		return errStreamFull
+	}
+}
+
+// Close ends the stream
+func (s *stream) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+// SendMessage accepts a message over plain HTTP and routes it like messages received on websockets
+func (ctrl *APIController) SendMessage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	logger := logging.FromContext(r.Context(), ctrl.logger)
+
+	user, err := auth.ParseToken(r.Header.Get(constants.HTTPAuthorization))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var msg models.Message
+	if err = json.NewDecoder(http.MaxBytesReader(w, r.Body, ctrl.maxFrameSize())).Decode(&msg); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	messages := func() bool { return ctrl.httpMessages.Allow(user.UserName) }
+	signals := func() bool { return ctrl.httpSignals.Allow(user.UserName) }
+
+	if rej := ctrl.accept(logger.With("user", user.UserName), user.UserName, msg, messages, signals); rej != nil {
+		http.Error(w, rej.reason, rej.code)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// StreamMessages delivers messages as server-sent events. Every event carries a JSON message or error frame,
+// the same frames websocket clients receive.
+func (ctrl *APIController) StreamMessages(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context(), ctrl.logger)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := auth.ParseToken(r.Header.Get(constants.HTTPAuthorization))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set(constants.HTTPContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// stops nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	writeEvent := func(frame []byte) error {
+		_, err := w.Write([]byte("data: " + string(frame) + "\n\n"))
+		return err
+	}
+
+	s := newStream()
+	cl := ctrl.newClient(logger, s, user.UserName, r.RemoteAddr)
+	queued := ctrl.addClient(cl)
+	cl.logger.Info("client connected", "transport", "sse")
+
+	// queued messages are written directly, they could fill the stream buffer before the loop below drains it
+	ctrl.deliverQueued(cl, queued, func(v interface{}) error {
+		frame, err := json.Marshal(v)
+		if err == nil {
+			err = writeEvent(frame)
+		}
+		return err
+	})
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case frame := <-s.frames:
+			err = writeEvent(frame)
+		case <-keepAlive.C:
+			_, err = w.Write([]byte(": keep-alive\n\n"))
+		case <-s.done:
+			err = errStreamClosed
+		case <-r.Context().Done():
+			err = r.Context().Err()
+		}
+
+		if err != nil {
+			cl.logger.Info("client disconnected", "error", err)
+			ctrl.removeClient(cl)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (ctrl *APIController) maxFrameSize() int64 {
+	if ctrl.config.Validation.MaxFrameSize > 0 {
+		return ctrl.config.Validation.MaxFrameSize
+	}
+	return 1 << 30
+}
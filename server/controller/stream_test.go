@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamMessages_DeliversSentMessage(t *testing.T) {
+	// arrange
+	controller := NewAPIController(slog.Default(), Config{})
+	sender, recipient := "stream-alice", "stream-bob"
+	auth.RegisterClient(sender, [32]byte{})
+	auth.RegisterClient(recipient, [32]byte{})
+
+	server := httptest.NewServer(http.HandlerFunc(controller.StreamMessages))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set(constants.HTTPAuthorization, "Bearer "+auth.CreateToken(&recipient))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Unable to open stream:", err)
+	}
+	defer resp.Body.Close()
+
+	for i := 0; i < 100 && len(controller.snapshotClients()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	msg := models.Message{SenderID: sender, RecipientID: recipient, Body: []byte("secret"), TimeStamp: time.Now().Format(constants.TimeStampFormat)}
+	payload, _ := json.Marshal(msg)
+	sendReq := httptest.NewRequest("POST", "/messages", bytes.NewReader(payload))
+	sendReq.Header.Set(constants.HTTPAuthorization, "Bearer "+auth.CreateToken(&sender))
+	wr := httptest.NewRecorder()
+
+	// act
+	controller.SendMessage(wr, sendReq)
+
+	// assert
+	if wr.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected status code. expected: %v, actual %v %v", http.StatusAccepted, wr.Code, wr.Body.String())
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "data: ") {
+		t.Fatalf("Unexpected event: %q %v", line, err)
+	}
+
+	var received models.Message
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &received)
+	if string(received.Body) != "secret" || received.SenderID != sender {
+		t.Errorf("Unexpected message: %+v", received)
+	}
+}
+
+func TestStreamMessages_DeliversQueuedBeyondBuffer(t *testing.T) {
+	// arrange
+	controller := NewAPIController(slog.Default(), Config{})
+	recipient := "stream-queued-bob"
+	count := streamBufferSize * 2
+	for i := 0; i < count; i++ {
+		controller.queue.Push(models.Message{SenderID: "stream-alice", RecipientID: recipient, Body: []byte(strconv.Itoa(i))})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(controller.StreamMessages))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set(constants.HTTPAuthorization, "Bearer "+auth.CreateToken(&recipient))
+	// act
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Unable to open stream:", err)
+	}
+	defer resp.Body.Close()
+
+	// assert
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < count; i++ {
+		line, err := reader.ReadString('\n')
+		for err == nil && line == "\n" {
+			line, err = reader.ReadString('\n')
+		}
+
+		var received models.Message
+		json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &received)
+		if err != nil || string(received.Body) != strconv.Itoa(i) {
+			t.Fatalf("Unexpected event %[1]d: %[2]q %[3]v", i, line, err)
+		}
+	}
+}
+
+func TestSendMessage_Rejected(t *testing.T) {
+	// arrange
+	var controller APIController
+	sender := "stream-mallory"
+	msg := models.Message{SenderID: "someone-else", RecipientID: "stream-bob", Body: []byte("secret"), TimeStamp: time.Now().Format(constants.TimeStampFormat)}
+	payload, _ := json.Marshal(msg)
+	req := httptest.NewRequest("POST", "/messages", bytes.NewReader(payload))
+	req.Header.Set(constants.HTTPAuthorization, "Bearer "+auth.CreateToken(&sender))
+	wr := httptest.NewRecorder()
+	// act
+	controller.SendMessage(wr, req)
+	// assert
+	if wr.Code != http.StatusForbidden {
+		t.Errorf("Message with spoofed sender was accepted: %v", wr.Code)
+	}
+}
+
+func TestStream_FullBuffer(t *testing.T) {
+	// arrange
+	s := newStream()
+	// act
+	var err error
+	for i := 0; i <= streamBufferSize && err == nil; i++ {
+		err = s.WriteFrame(models.ErrorFrame{Error: "frame", Code: i})
+	}
+	// assert
+	if err != errStreamFull {
+		t.Errorf("Expected full buffer error, got: %v", err)
+	}
+
+	s.Close()
+	if s.WriteFrame(models.ErrorFrame{}) != errStreamClosed {
+		t.Error("Closed stream accepted a frame")
+	}
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"net/http"
+)
+
+// WebsocketTicket exchanges the caller's token for a short-lived single-use ticket accepted by /websockets?ticket=
+func (ctrl *APIController) WebsocketTicket(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ParseToken(r.Header.Get(constants.HTTPAuthorization))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	ticket, expires, err := auth.CreateWebsocketTicket(user)
+	if err == auth.ErrTooManyTickets {
+		http.Error(w, "Too many outstanding websocket tickets", http.StatusTooManyRequests)
+		return
+	}
+
+	if err != nil {
+		ctrl.log().Error("unable to create websocket ticket", "error", err)
+		http.Error(w, "Unable to create websocket ticket", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, models.WebsocketTicketResponse{Ticket: ticket, Expires: expires.Unix()})
+}
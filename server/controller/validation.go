@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Validation holds limits applied to incoming websocket messages. Zero values disable the check.
+type Validation struct {
+	// MaxFrameSize is the largest websocket frame in bytes read from a client, bigger frames close the connection
+	MaxFrameSize int64
+	// MaxBodySize is the largest encrypted message body in bytes
+	MaxBodySize int
+	// MaxClockSkew is how far message timestamp may drift from server time
+	MaxClockSkew time.Duration
+}
+
+// rejection describes why a message was not accepted and is reported back to the sender
+type rejection struct {
+	reason string
+	code   int
+}
+
+// signalsLimited is returned for rate limited typing indicators, it is not reported to websocket clients
+var signalsLimited = &rejection{"Too many signals", http.StatusTooManyRequests}
+
+// validate checks message sent by authenticated user and returns nil if it can be delivered.
+// userID is empty for sealed sender messages posted anonymously.
+func (ctrl *APIController) validate(userID string, msg *models.Message) *rejection {
+	if msg.RecipientID == "" {
+		return &rejection{"Missing recipient", http.StatusBadRequest}
+	}
+
+	if msg.Sealed {
+		if rej := validateSealed(msg); rej != nil {
+			return rej
+		}
+	} else if rej := ctrl.validateSender(userID, msg); rej != nil {
+		return rej
+	}
+
+	if len(msg.Body) == 0 {
+		return &rejection{"Empty message body", http.StatusBadRequest}
+	}
+
+	if max := ctrl.config.Validation.MaxBodySize; max > 0 && len(msg.Body) > max {
+		return &rejection{"Message body too large", http.StatusRequestEntityTooLarge}
+	}
+
+	if len(msg.ID) > models.MaxMessageIDLength || len(msg.Retracts) > models.MaxMessageIDLength {
+		return &rejection{"Invalid message id", http.StatusBadRequest}
+	}
+
+	if msg.TTL < 0 || msg.TTL > ctrl.maxTTL() {
+		return &rejection{"Invalid TTL", http.StatusBadRequest}
+	}
+
+	if !auth.IsRegistered(msg.RecipientID) {
+		return &rejection{"Unknown recipient", http.StatusNotFound}
+	}
+
+	return nil
+}
+
+// maxTTL is the longest advisory TTL in seconds, queued messages are purged after the queue retention anyway
+func (ctrl *APIController) maxTTL() int64 {
+	if ctrl.config.QueueRetention > 0 {
+		return int64(ctrl.config.QueueRetention / time.Second)
+	}
+	return int64(math.MaxInt64 / time.Second)
+}
+
+func (ctrl *APIController) validateSender(userID string, msg *models.Message) *rejection {
+	if msg.SenderID == "" {
+		return &rejection{"Missing sender", http.StatusBadRequest}
+	}
+
+	if msg.SenderID != userID {
+		return &rejection{"Sender does not match authenticated user", http.StatusForbidden}
+	}
+
+	timeStamp, err := time.Parse(constants.TimeStampFormat, msg.TimeStamp)
+	if err != nil {
+		return &rejection{"Invalid timestamp format", http.StatusBadRequest}
+	}
+
+	if max := ctrl.config.Validation.MaxClockSkew; max > 0 {
+		skew := time.Since(timeStamp)
+		if skew > max || -skew > max {
+			return &rejection{"Timestamp outside of allowed clock skew", http.StatusBadRequest}
+		}
+	}
+
+	return nil
+}
+
+// sealed sender messages keep sender and timestamp inside the encrypted body and are authorized by a delivery certificate
+func validateSealed(msg *models.Message) *rejection {
+	if msg.SenderID != "" || msg.TimeStamp != "" {
+		return &rejection{"Sealed message must not reveal sender or timestamp", http.StatusBadRequest}
+	}
+
+	if err := auth.VerifyDeliveryCertificate(msg.Certificate); err != nil {
+		return &rejection{"Invalid delivery certificate", http.StatusUnauthorized}
+	}
+
+	return nil
+}
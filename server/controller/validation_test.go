@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/common/models"
+	"ciphertalk/server/auth"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validMessage() models.Message {
+	return models.Message{
+		SenderID:    "alice",
+		RecipientID: "bob",
+		Body:        []byte("sealed"),
+		TimeStamp:   time.Now().UTC().Format(constants.TimeStampFormat),
+	}
+}
+
+var invalidMessageTable = []struct {
+	name   string
+	modify func(msg *models.Message)
+	code   int
+}{
+	{"missing recipient", func(msg *models.Message) { msg.RecipientID = "" }, http.StatusBadRequest},
+	{"missing sender", func(msg *models.Message) { msg.SenderID = "" }, http.StatusBadRequest},
+	{"spoofed sender", func(msg *models.Message) { msg.SenderID = "mallory" }, http.StatusForbidden},
+	{"empty body", func(msg *models.Message) { msg.Body = nil }, http.StatusBadRequest},
+	{"body too large", func(msg *models.Message) { msg.Body = make([]byte, 17) }, http.StatusRequestEntityTooLarge},
+	{"invalid timestamp", func(msg *models.Message) { msg.TimeStamp = "yesterday" }, http.StatusBadRequest},
+	{"old timestamp", func(msg *models.Message) {
+		msg.TimeStamp = time.Now().Add(-time.Hour).Format(constants.TimeStampFormat)
+	}, http.StatusBadRequest},
+	{"negative ttl", func(msg *models.Message) { msg.TTL = -1 }, http.StatusBadRequest},
+	{"ttl longer than retention", func(msg *models.Message) { msg.TTL = 3601 }, http.StatusBadRequest},
+	{"huge ttl", func(msg *models.Message) { msg.TTL = math.MaxInt64 }, http.StatusBadRequest},
+	{"long id", func(msg *models.Message) { msg.ID = strings.Repeat("a", 65) }, http.StatusBadRequest},
+	{"unknown recipient", func(msg *models.Message) { msg.RecipientID = "nobody" }, http.StatusNotFound},
+}
+
+func TestValidate(t *testing.T) {
+	// arrange
+	auth.RegisterClient("bob", [32]byte{})
+	controller := APIController{config: Config{
+		QueueRetention: time.Hour,
+		Validation:     Validation{MaxBodySize: 16, MaxClockSkew: time.Minute},
+	}}
+	msg := validMessage()
+	// act
+	rej := controller.validate("alice", &msg)
+	// assert
+	if rej != nil {
+		t.Errorf("Unexpected rejection: %v", rej.reason)
+	}
+}
+
+func TestValidate_Rejections(t *testing.T) {
+	auth.RegisterClient("bob", [32]byte{})
+	controller := APIController{config: Config{
+		QueueRetention: time.Hour,
+		Validation:     Validation{MaxBodySize: 16, MaxClockSkew: time.Minute},
+	}}
+
+	for _, entry := range invalidMessageTable {
+		// arrange
+		msg := validMessage()
+		entry.modify(&msg)
+		// act
+		rej := controller.validate("alice", &msg)
+		// assert
+		if rej == nil {
+			t.Errorf("%v: expected message to be rejected", entry.name)
+			continue
+		}
+
+		if rej.code != entry.code {
+			t.Errorf("%v: unexpected code. expected: %v, actual: %v", entry.name, entry.code, rej.code)
+		}
+	}
+}
+
+func TestValidate_Sealed(t *testing.T) {
+	// arrange
+	auth.RegisterClient("bob", [32]byte{})
+	var controller APIController
+	certificate, _ := auth.CreateDeliveryCertificate()
+	msg := models.Message{RecipientID: "bob", Body: []byte("sealed"), Sealed: true, Certificate: certificate}
+	// act
+	rej := controller.validate("", &msg)
+	// assert
+	if rej != nil {
+		t.Errorf("Unexpected rejection: %v", rej.reason)
+	}
+}
+
+var invalidSealedTable = []struct {
+	name   string
+	modify func(msg *models.Message)
+	code   int
+}{
+	{"revealed sender", func(msg *models.Message) { msg.SenderID = "alice" }, http.StatusBadRequest},
+	{"revealed timestamp", func(msg *models.Message) { msg.TimeStamp = "2017-01-01T00:00:00Z" }, http.StatusBadRequest},
+	{"missing certificate", func(msg *models.Message) { msg.Certificate = "" }, http.StatusUnauthorized},
+	{"auth token as certificate", func(msg *models.Message) {
+		user := "alice"
+		msg.Certificate = auth.CreateToken(&user)
+	}, http.StatusUnauthorized},
+}
+
+func TestValidate_SealedRejections(t *testing.T) {
+	auth.RegisterClient("bob", [32]byte{})
+	var controller APIController
+	certificate, _ := auth.CreateDeliveryCertificate()
+
+	for _, entry := range invalidSealedTable {
+		// arrange
+		msg := models.Message{RecipientID: "bob", Body: []byte("sealed"), Sealed: true, Certificate: certificate}
+		entry.modify(&msg)
+		// act
+		rej := controller.validate("", &msg)
+		// assert
+		if rej == nil || rej.code != entry.code {
+			t.Errorf("%v: expected rejection with code %v, actual: %v", entry.name, entry.code, rej)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config describes how server logs are formatted and redacted
+type Config struct {
+	Level       string
+	JSON        bool
+	HashUserIDs bool
+	// HashKey keys the pseudonyms of user ids, a random key is generated when it is empty
+	// so pseudonyms can only be linked within one process
+	HashKey []byte
+}
+
+// Attribute keys which carry secrets and are never written to the log
+var redactedKeys = map[string]bool{
+	"body":          true,
+	"token":         true,
+	"authorization": true,
+	"public_key":    true,
+	"password":      true,
+}
+
+// Attribute keys which carry user identities and are hashed when Config.HashUserIDs is set
+var userKeys = map[string]bool{
+	"user":      true,
+	"issuer":    true,
+	"sender":    true,
+	"recipient": true,
+}
+
+// New creates a structured logger writing to w
+func New(w io.Writer, cfg Config) *slog.Logger {
+	if cfg.HashUserIDs && len(cfg.HashKey) == 0 {
+		cfg.HashKey = make([]byte, 32)
+		rand.Read(cfg.HashKey)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: parseLevel(cfg.Level),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			return redact(cfg, a)
+		},
+	}
+
+	if cfg.JSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+
+	return slog.LevelInfo
+}
+
+func redact(cfg Config, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+
+	if redactedKeys[key] {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+
+	if cfg.HashUserIDs && userKeys[key] {
+		return slog.String(a.Key, HashID(cfg.HashKey, a.Value.String()))
+	}
+
+	return a
+}
+
+// HashID returns a short pseudonym for a user id which is stable for the same key.
+// It is keyed with HMAC so pseudonyms can not be reversed by hashing a list of user names.
+func HashID(key []byte, id string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// NewID generates a random identifier for requests and connections
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type contextKey struct{}
+
+type routeKey struct{}
+
+// SetRoute records the route template which matched the request, Middleware logs it instead of the path
+// so user names in paths such as /admin/users/{name} are not written to the log
+func SetRoute(r *http.Request, template string) {
+	if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+		*route = template
+	}
+}
+
+// WithLogger stores logger in the context
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns logger stored in the context or fallback if there is none
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	if fallback != nil {
+		return fallback
+	}
+
+	return slog.Default()
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack lets websocket upgrades take over the underlying connection
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+
+	sr.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Middleware assigns a request id, attaches a request scoped logger to the context
+// and logs method, path, status and duration of every request.
+// Query strings and headers are not logged since they may carry credentials, paths are replaced by the route
+// template recorded with SetRoute.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = NewID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		reqLogger := logger.With("request_id", requestID)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		route := new(string)
+
+		ctx := context.WithValue(WithLogger(r.Context(), reqLogger), routeKey{}, route)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		path := r.URL.Path
+		if *route != "" {
+			path = *route
+		}
+
+		reqLogger.Info("request",
+			"method", r.Method,
+			"path", path,
+			"status", rec.status,
+			"duration", time.Since(start))
+	})
+}
+
+// Flush lets streaming responses such as server-sent events reach the client immediately
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
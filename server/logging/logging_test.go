@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew_RedactsSecrets(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	logger := New(&out, Config{JSON: true})
+	// act
+	logger.Info("message received", "body", "ciphertext", "token", "secret-token")
+	// assert
+	if strings.Contains(out.String(), "ciphertext") || strings.Contains(out.String(), "secret-token") {
+		t.Errorf("Secret values were written to the log: %s", out.String())
+	}
+}
+
+func TestNew_HashesUserIDs(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	key := []byte("log-key")
+	logger := New(&out, Config{JSON: true, HashUserIDs: true, HashKey: key})
+	// act
+	logger.Info("token issued", "user", "foo@bar.com", "issuer", "admin@bar.com")
+	// assert
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("Log entry is not valid JSON: %v", err)
+	}
+
+	if entry["user"] != HashID(key, "foo@bar.com") {
+		t.Errorf("User id was not hashed: %v", entry["user"])
+	}
+
+	if entry["issuer"] != HashID(key, "admin@bar.com") {
+		t.Errorf("Issuer was not hashed: %v", entry["issuer"])
+	}
+}
+
+func TestHashID_Keyed(t *testing.T) {
+	// act
+	first := HashID([]byte("first-key"), "foo@bar.com")
+	second := HashID([]byte("second-key"), "foo@bar.com")
+	unkeyed := sha256.Sum256([]byte("foo@bar.com"))
+
+	// assert
+	if first == second {
+		t.Error("Expected pseudonyms to depend on the key")
+	}
+	if first == hex.EncodeToString(unkeyed[:8]) {
+		t.Error("Expected pseudonym to differ from the plain sha256 of the user id")
+	}
+}
+
+func TestNew_RandomHashKey(t *testing.T) {
+	// arrange
+	var first, second bytes.Buffer
+	// act
+	New(&first, Config{HashUserIDs: true}).Info("client connected", "user", "foo@bar.com")
+	New(&second, Config{HashUserIDs: true}).Info("client connected", "user", "foo@bar.com")
+	// assert
+	if strings.Contains(first.String(), "foo@bar.com") {
+		t.Errorf("User id was not hashed: %s", first.String())
+	}
+	if pseudonym(first.String()) == pseudonym(second.String()) {
+		t.Error("Expected loggers without a key to use different random keys")
+	}
+}
+
+func pseudonym(line string) string {
+	return line[strings.Index(line, "user="):]
+}
+
+func TestNew_Level(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	logger := New(&out, Config{Level: "warn"})
+	// act
+	logger.Info("hidden")
+	// assert
+	if out.Len() != 0 {
+		t.Errorf("Info entry should be filtered out: %s", out.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	logger := New(&out, Config{JSON: true})
+	var requestLogger bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, requestLogger = r.Context().Value(contextKey{}).(*slog.Logger)
+		w.WriteHeader(http.StatusTeapot)
+	})
+	wr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/secure?token=secret-token", nil)
+	// act
+	Middleware(logger, next).ServeHTTP(wr, req)
+	// assert
+	if wr.Header().Get("X-Request-ID") == "" {
+		t.Error("Request id header was not set")
+	}
+
+	if !requestLogger {
+		t.Error("Request logger was not attached to the context")
+	}
+
+	if strings.Contains(out.String(), "secret-token") {
+		t.Error("Query string was written to the log")
+	}
+
+	if !strings.Contains(out.String(), "\"status\":418") {
+		t.Errorf("Response status was not logged: %s", out.String())
+	}
+}
+
+func TestMiddleware_Route(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	logger := New(&out, Config{JSON: true})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r, "/admin/users/{name}/ban")
+	})
+	req := httptest.NewRequest("PUT", "/admin/users/foo@bar.com/ban", nil)
+	// act
+	Middleware(logger, next).ServeHTTP(httptest.NewRecorder(), req)
+	// assert
+	if strings.Contains(out.String(), "foo@bar.com") {
+		t.Errorf("User name in the path was written to the log: %s", out.String())
+	}
+
+	if !strings.Contains(out.String(), "/admin/users/{name}/ban") {
+		t.Errorf("Route template was not logged: %s", out.String())
+	}
+}
@@ -0,0 +1,261 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	value uint64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value returns current value of the counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	value int64
+}
+
+// Inc increments the gauge by one
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+// Dec decrements the gauge by one
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+// Value returns current value of the gauge
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// CounterVec is a set of counters partitioned by a single label
+type CounterVec struct {
+	label    string
+	mutex    sync.Mutex
+	counters map[string]*Counter
+}
+
+// NewCounterVec creates new instance of CounterVec
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{label: label, counters: make(map[string]*Counter)}
+}
+
+// With returns the counter for a given label value, creating it if necessary
+func (cv *CounterVec) With(value string) *Counter {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	c, ok := cv.counters[value]
+	if !ok {
+		c = new(Counter)
+		cv.counters[value] = c
+	}
+
+	return c
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	mutex   sync.Mutex
+	bounds  []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// DefaultBuckets are latency buckets in seconds
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// NewHistogram creates new instance of Histogram with given upper bounds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+// Observe records a single observation
+func (h *Histogram) Observe(v float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Count returns number of recorded observations
+func (h *Histogram) Count() uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count
+}
+
+// HistogramVec is a set of histograms partitioned by a single label
+type HistogramVec struct {
+	label      string
+	bounds     []float64
+	mutex      sync.Mutex
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec creates new instance of HistogramVec
+func NewHistogramVec(label string, bounds []float64) *HistogramVec {
+	return &HistogramVec{label: label, bounds: bounds, histograms: make(map[string]*Histogram)}
+}
+
+// With returns the histogram for a given label value, creating it if necessary
+func (hv *HistogramVec) With(value string) *Histogram {
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+
+	h, ok := hv.histograms[value]
+	if !ok {
+		h = NewHistogram(hv.bounds)
+		hv.histograms[value] = h
+	}
+
+	return h
+}
+
+// Chat server metrics
+var (
+	ActiveSockets   = new(Gauge)
+	MessagesRouted  = new(Counter)
+	MessagesDropped = new(Counter)
+	MessagesQueued  = new(Counter)
+	MessagesExpired = new(Counter)
+	SignalsRelayed  = new(Counter)
+	// MessagesRetracted counts messages deleted by their sender before the recipient came online
+	MessagesRetracted = new(Counter)
+	BytesRelayed      = new(Counter)
+	LoginAttempts     = NewCounterVec("outcome")
+	SecureLookups     = NewCounterVec("result")
+	RequestDuration   = NewHistogramVec("handler", DefaultBuckets)
+)
+
+type metric struct {
+	name      string
+	help      string
+	kind      string
+	collector interface{}
+}
+
+var registry = []metric{
+	{"ciphertalk_active_sockets", "Number of open websocket connections", "gauge", ActiveSockets},
+	{"ciphertalk_messages_routed_total", "Messages delivered to an online recipient", "counter", MessagesRouted},
+	{"ciphertalk_messages_dropped_total", "Messages that could not be delivered", "counter", MessagesDropped},
+	{"ciphertalk_messages_queued_total", "Messages queued for offline recipients", "counter", MessagesQueued},
+	{"ciphertalk_messages_expired_total", "Queued messages purged after their retention or TTL", "counter", MessagesExpired},
+	{"ciphertalk_messages_retracted_total", "Queued messages deleted by their sender before delivery", "counter", MessagesRetracted},
+	{"ciphertalk_signals_relayed_total", "Ephemeral signals such as typing indicators delivered to online recipients", "counter", SignalsRelayed},
+	{"ciphertalk_bytes_relayed_total", "Encrypted message body bytes delivered to recipients", "counter", BytesRelayed},
+	{"ciphertalk_login_attempts_total", "Login attempts by outcome", "counter", LoginAttempts},
+	{"ciphertalk_secure_lookups_total", "Public key lookups by result", "counter", SecureLookups},
+	{"ciphertalk_request_duration_seconds", "HTTP handler latency", "histogram", RequestDuration},
+}
+
+// WriteTo writes all registered metrics in Prometheus text exposition format
+func WriteTo(w io.Writer) {
+	for _, m := range registry {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+
+		switch c := m.collector.(type) {
+		case *Counter:
+			fmt.Fprintf(w, "%s %d\n", m.name, c.Value())
+		case *Gauge:
+			fmt.Fprintf(w, "%s %d\n", m.name, c.Value())
+		case *CounterVec:
+			c.mutex.Lock()
+			for _, value := range sortedKeys(c.counters) {
+				fmt.Fprintf(w, "%s{%s=%q} %d\n", m.name, c.label, value, c.counters[value].Value())
+			}
+			c.mutex.Unlock()
+		case *HistogramVec:
+			c.mutex.Lock()
+			for _, value := range sortedKeys(c.histograms) {
+				writeHistogram(w, m.name, fmt.Sprintf("%s=%q", c.label, value), c.histograms[value])
+			}
+			c.mutex.Unlock()
+		}
+	}
+}
+
+func writeHistogram(w io.Writer, name string, labels string, h *Histogram) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), h.buckets[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch t := m.(type) {
+	case map[string]*Counter:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]*Histogram:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Handler serves registered metrics to the Prometheus scraper
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WriteTo(w)
+	})
+}
+
+// Instrument wraps a handler and records its latency under the given name
+func Instrument(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		RequestDuration.With(name).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	// arrange
+	vec := NewCounterVec("outcome")
+	// act
+	vec.With("success").Inc()
+	vec.With("success").Add(2)
+	vec.With("failure").Inc()
+	// assert
+	if vec.With("success").Value() != 3 {
+		t.Errorf("Unexpected counter value. expected: 3, actual: %v", vec.With("success").Value())
+	}
+
+	if vec.With("failure").Value() != 1 {
+		t.Errorf("Unexpected counter value. expected: 1, actual: %v", vec.With("failure").Value())
+	}
+}
+
+func TestHistogram_Observe(t *testing.T) {
+	// arrange
+	h := NewHistogram([]float64{0.1, 1})
+	// act
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+	// assert
+	if h.Count() != 3 {
+		t.Errorf("Unexpected count. expected: 3, actual: %v", h.Count())
+	}
+
+	if h.buckets[0] != 1 || h.buckets[1] != 2 {
+		t.Errorf("Buckets are not cumulative: %v", h.buckets)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	// arrange
+	ActiveSockets.Set(2)
+	LoginAttempts.With("success").Inc()
+	RequestDuration.With("login").Observe(0.002)
+	var out bytes.Buffer
+	// act
+	WriteTo(&out)
+	// assert
+	expected := []string{
+		"# TYPE ciphertalk_active_sockets gauge",
+		"ciphertalk_active_sockets 2",
+		"ciphertalk_login_attempts_total{outcome=\"success\"}",
+		"ciphertalk_request_duration_seconds_bucket{handler=\"login\",le=\"0.005\"} 1",
+		"ciphertalk_request_duration_seconds_count{handler=\"login\"} 1",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected output to contain %q", line)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	// arrange
+	wr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	// act
+	Handler().ServeHTTP(wr, req)
+	// assert
+	if wr.Code != http.StatusOK {
+		t.Errorf("Unexpected status code. expected: %v, actual %v", http.StatusOK, wr.Code)
+	}
+
+	if !strings.HasPrefix(wr.Header().Get("Content-Type"), "text/plain") {
+		t.Error("Content-Type header was not set")
+	}
+}
@@ -0,0 +1,80 @@
+package origin
+
+import (
+	"ciphertalk/common/constants"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// AllowList holds origins of browser clients which may use the API from other sites, e.g. "https://chat.example.com".
+// "*" allows every origin.
+type AllowList []string
+
+// String implements flag.Value
+func (l *AllowList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value, parses comma separated origins
+func (l *AllowList) Set(value string) error {
+	*l = nil
+	for _, o := range strings.Split(value, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			*l = append(*l, o)
+		}
+	}
+	return nil
+}
+
+// Allows returns true if the origin is in the allow-list
+func (l AllowList) Allows(origin string) bool {
+	for _, o := range l {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin is used by the websocket upgrader. Requests without Origin come from non-browser clients and
+// are allowed, same as requests from the server's own origin. Other browser origins must be in the allow-list,
+// otherwise any site could open a websocket with a token it obtained from the user.
+func (l AllowList) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return l.Allows(origin)
+}
+
+// CORS returns middleware which answers preflight requests and allows cross-origin requests from the allow-list.
+// Routes wrapped with it have to accept OPTIONS.
+func (l AllowList) CORS() func(http.Handler) http.Handler {
+	cors := handlers.CORS(
+		handlers.AllowedOriginValidator(l.Allows),
+		handlers.AllowedMethods([]string{constants.HTTPGet, constants.HTTPPost}),
+		handlers.AllowedHeaders([]string{constants.HTTPContentType, constants.HTTPAuthorization}),
+		handlers.MaxAge(600),
+	)
+
+	return func(next http.Handler) http.Handler {
+		h := cors(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// responses depend on the origin, so caches must not share them between origins
+			w.Header().Add("Vary", "Origin")
+			h.ServeHTTP(w, r)
+		})
+	}
+}
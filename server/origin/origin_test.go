@@ -0,0 +1,74 @@
+package origin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var checkOriginTable = []struct {
+	allowed  string
+	origin   string
+	expected bool
+}{
+	{"", "", true},
+	{"", "http://localhost:3000", true},
+	{"", "https://evil.example.com", false},
+	{"https://chat.example.com", "https://chat.example.com", true},
+	{"https://chat.example.com/", "https://CHAT.example.com", true},
+	{"https://chat.example.com", "http://chat.example.com", false},
+	{"https://a.example.com, https://b.example.com", "https://b.example.com", true},
+	{"*", "https://evil.example.com", true},
+}
+
+func TestCheckOrigin(t *testing.T) {
+	for _, entry := range checkOriginTable {
+		// arrange
+		var allowed AllowList
+		allowed.Set(entry.allowed)
+		req := httptest.NewRequest("GET", "http://localhost:3000/websockets", nil)
+		if entry.origin != "" {
+			req.Header.Set("Origin", entry.origin)
+		}
+		// act
+		result := allowed.CheckOrigin(req)
+		// assert
+		if result != entry.expected {
+			t.Errorf("Unexpected result for origin %q with allow-list %q: %v", entry.origin, entry.allowed, result)
+		}
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	// arrange
+	allowed := AllowList{"https://chat.example.com"}
+	handler := allowed.CORS()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Preflight request reached the handler")
+	}))
+	req := httptest.NewRequest("OPTIONS", "/login", nil)
+	req.Header.Set("Origin", "https://chat.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type, Authorization")
+	wr := httptest.NewRecorder()
+	// act
+	handler.ServeHTTP(wr, req)
+	// assert
+	if wr.Header().Get("Access-Control-Allow-Origin") != "https://chat.example.com" {
+		t.Errorf("Unexpected headers: %v", wr.Header())
+	}
+}
+
+func TestCORS_RejectsUnknownOrigin(t *testing.T) {
+	// arrange
+	allowed := AllowList{"https://chat.example.com"}
+	handler := allowed.CORS()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	wr := httptest.NewRecorder()
+	// act
+	handler.ServeHTTP(wr, req)
+	// assert
+	if wr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Unknown origin was allowed: %v", wr.Header())
+	}
+}
@@ -0,0 +1,167 @@
+package queue
+
+import (
+	"ciphertalk/common/models"
+	"sync"
+	"time"
+)
+
+// now is replaced in tests to control the clock
+var now = time.Now
+
+// Entry is a queued message, it keeps the message's expiry when it is popped and requeued
+type Entry struct {
+	Message models.Message
+	expires time.Time
+}
+
+// Queue keeps messages for offline recipients until they connect or the messages expire.
+// Messages are purged after the queue retention or the message's advisory TTL, whichever comes first.
+type Queue struct {
+	mutex      sync.Mutex
+	messages   map[string][]Entry
+	maxPerUser int
+	retention  time.Duration
+}
+
+// New creates new instance of Queue. Zero maxPerUser means no limit, zero retention keeps messages until delivered.
+func New(maxPerUser int, retention time.Duration) *Queue {
+	return &Queue{messages: make(map[string][]Entry), maxPerUser: maxPerUser, retention: retention}
+}
+
+// Push stores message for its recipient and returns false if the recipient's queue is full
+func (q *Queue) Push(msg models.Message) bool {
+	if q == nil {
+		return false
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	pending := q.messages[msg.RecipientID]
+	if q.maxPerUser > 0 && len(pending) >= q.maxPerUser {
+		return false
+	}
+
+	q.messages[msg.RecipientID] = append(pending, Entry{Message: msg, expires: q.expiry(msg)})
+	return true
+}
+
+func (q *Queue) expiry(msg models.Message) time.Time {
+	var expires time.Time
+	if q.retention > 0 {
+		expires = now().Add(q.retention)
+	}
+
+	if msg.TTL > 0 {
+		ttl := now().Add(time.Duration(msg.TTL) * time.Second)
+		if expires.IsZero() || ttl.Before(expires) {
+			expires = ttl
+		}
+	}
+
+	return expires
+}
+
+// Pop removes and returns all unexpired messages queued for the recipient
+func (q *Queue) Pop(recipient string) []Entry {
+	if q == nil {
+		return nil
+	}
+
+	q.mutex.Lock()
+	pending := q.messages[recipient]
+	delete(q.messages, recipient)
+	q.mutex.Unlock()
+
+	var result []Entry
+	t := now()
+	for _, e := range pending {
+		if e.expires.IsZero() || t.Before(e.expires) {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// Requeue puts messages popped for the recipient back in front of its queue when they could not be delivered.
+// The queue limit is not applied because the messages were accepted before, they keep their original expiry.
+func (q *Queue) Requeue(recipient string, entries []Entry) {
+	if q == nil || len(entries) == 0 {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.messages[recipient] = append(append([]Entry(nil), entries...), q.messages[recipient]...)
+}
+
+// Remove deletes a queued message by its id and returns true if it was found. The message is only removed if it
+// was sent by senderID, so sealed messages, which have no sender, can not be retracted by anyone.
+func (q *Queue) Remove(recipient string, id string, senderID string) bool {
+	if q == nil || id == "" || senderID == "" {
+		return false
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	pending := q.messages[recipient]
+	for i, e := range pending {
+		if e.Message.ID == id && e.Message.SenderID == senderID {
+			q.messages[recipient] = append(pending[:i], pending[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Purge removes expired messages and returns how many were removed
+func (q *Queue) Purge() int {
+	if q == nil {
+		return 0
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	purged := 0
+	t := now()
+	for recipient, pending := range q.messages {
+		kept := pending[:0]
+		for _, e := range pending {
+			if e.expires.IsZero() || t.Before(e.expires) {
+				kept = append(kept, e)
+			} else {
+				purged++
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(q.messages, recipient)
+		} else {
+			q.messages[recipient] = kept
+		}
+	}
+
+	return purged
+}
+
+// Len returns number of queued messages
+func (q *Queue) Len() int {
+	if q == nil {
+		return 0
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	total := 0
+	for _, pending := range q.messages {
+		total += len(pending)
+	}
+	return total
+}
@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"ciphertalk/common/models"
+	"testing"
+	"time"
+)
+
+func withClock(t time.Time) func(d time.Duration) {
+	current := t
+	now = func() time.Time { return current }
+	return func(d time.Duration) { current = current.Add(d) }
+}
+
+func TestPushAndPop(t *testing.T) {
+	// arrange
+	q := New(0, 0)
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("1")})
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("2")})
+	q.Push(models.Message{RecipientID: "alice", Body: []byte("3")})
+	// act
+	result := q.Pop("bob")
+	// assert
+	if len(result) != 2 || string(result[0].Message.Body) != "1" || string(result[1].Message.Body) != "2" {
+		t.Errorf("Unexpected messages: %v", result)
+	}
+
+	if len(q.Pop("bob")) != 0 {
+		t.Error("Popped messages should be removed from the queue")
+	}
+
+	if q.Len() != 1 {
+		t.Errorf("Unexpected queue length. expected: 1, actual: %v", q.Len())
+	}
+}
+
+func TestRequeue_KeepsOrder(t *testing.T) {
+	// arrange
+	q := New(1, 0)
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("1")})
+	popped := q.Pop("bob")
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("2")})
+	// act
+	q.Requeue("bob", popped)
+	// assert
+	result := q.Pop("bob")
+	if len(result) != 2 || string(result[0].Message.Body) != "1" || string(result[1].Message.Body) != "2" {
+		t.Errorf("Unexpected messages: %v", result)
+	}
+}
+
+func TestRequeue_KeepsExpiry(t *testing.T) {
+	// arrange
+	advance := withClock(time.Unix(0, 0))
+	defer func() { now = time.Now }()
+	q := New(0, time.Hour)
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("requeued")})
+	advance(30 * time.Minute)
+	// act
+	q.Requeue("bob", q.Pop("bob"))
+	advance(30 * time.Minute)
+	// assert
+	if purged := q.Purge(); purged != 1 {
+		t.Errorf("Requeued message should expire after its original retention, purged: %v", purged)
+	}
+}
+
+func TestPush_Full(t *testing.T) {
+	q := New(1, 0)
+
+	if !q.Push(models.Message{RecipientID: "bob"}) {
+		t.Fatal("First message should be queued")
+	}
+
+	if q.Push(models.Message{RecipientID: "bob"}) {
+		t.Error("Message over the per user limit should be rejected")
+	}
+}
+
+func TestPurge_TTLAndRetention(t *testing.T) {
+	// arrange
+	advance := withClock(time.Unix(0, 0))
+	defer func() { now = time.Now }()
+	q := New(0, time.Hour)
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("ttl"), TTL: 60})
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("ttl longer than retention"), TTL: 7200})
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("retention")})
+	// act
+	advance(2 * time.Minute)
+	afterTTL := q.Purge()
+	advance(time.Hour)
+	afterRetention := q.Purge()
+	// assert
+	if afterTTL != 1 {
+		t.Errorf("Message should be purged after its TTL, purged: %v", afterTTL)
+	}
+
+	if afterRetention != 2 {
+		t.Errorf("Messages should be purged after retention, purged: %v", afterRetention)
+	}
+}
+
+func TestPop_SkipsExpired(t *testing.T) {
+	// arrange
+	advance := withClock(time.Unix(0, 0))
+	defer func() { now = time.Now }()
+	q := New(0, 0)
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("expired"), TTL: 1})
+	q.Push(models.Message{RecipientID: "bob", Body: []byte("kept")})
+	// act
+	advance(time.Second)
+	result := q.Pop("bob")
+	// assert
+	if len(result) != 1 || string(result[0].Message.Body) != "kept" {
+		t.Errorf("Unexpected messages: %v", result)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	// arrange
+	q := New(0, 0)
+	q.Push(models.Message{ID: "1", SenderID: "alice", RecipientID: "bob"})
+	q.Push(models.Message{ID: "2", SenderID: "alice", RecipientID: "bob"})
+	q.Push(models.Message{ID: "3", RecipientID: "bob", Sealed: true})
+	// act & assert
+	if q.Remove("bob", "1", "mallory") {
+		t.Error("Message should only be removed by its sender")
+	}
+
+	if !q.Remove("bob", "1", "alice") {
+		t.Error("Message should be removed by its sender")
+	}
+
+	if q.Remove("bob", "3", "") || q.Remove("bob", "3", "mallory") {
+		t.Error("Sealed message should not be removed")
+	}
+
+	if result := q.Pop("bob"); len(result) != 2 || result[0].Message.ID != "2" || result[1].Message.ID != "3" {
+		t.Errorf("Unexpected messages: %v", result)
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"ciphertalk/server/auth"
+	"context"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCLimit limits calls of a gRPC method per peer address and per user from the authorization metadata,
+// nil limiters do not limit anything
+type GRPCLimit struct {
+	ByIP   *Limiter
+	ByUser *Limiter
+}
+
+// GRPCLimits maps full gRPC method names to their limits. Methods which are not listed are not limited.
+type GRPCLimits map[string]GRPCLimit
+
+// UnaryInterceptor rejects unary calls with ResourceExhausted once a bucket is empty, like Middleware does for HTTP
+func (limits GRPCLimits) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := limits.allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor rejects streaming calls with ResourceExhausted once a bucket is empty
+func (limits GRPCLimits) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := limits.allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (limits GRPCLimits) allow(ctx context.Context, method string) error {
+	limit, ok := limits[method]
+	if !ok {
+		return nil
+	}
+
+	if k := peerIP(ctx); k != "" && !limit.ByIP.Allow(k) {
+		return exhausted(ctx, limit.ByIP)
+	}
+
+	if k := peerUser(ctx); k != "" && !limit.ByUser.Allow(k) {
+		return exhausted(ctx, limit.ByUser)
+	}
+
+	return nil
+}
+
+func exhausted(ctx context.Context, l *Limiter) error {
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(l.Config().RetryAfter())))
+	return status.Error(codes.ResourceExhausted, "Too many requests")
+}
+
+// peerIP keys calls by the peer's address like ByIP does for requests
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// peerUser keys calls by the user name from the token in the authorization metadata like ByUser does for requests
+func peerUser(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+
+	user, err := auth.ParseToken(values[0])
+	if err != nil {
+		return ""
+	}
+	return user.UserName
+}
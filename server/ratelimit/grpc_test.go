@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"ciphertalk/server/auth"
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcCall returns the context of a call from the peer address with an optional token of user
+func grpcCall(addr string, user string) context.Context {
+	ip, _ := net.ResolveTCPAddr("tcp", addr)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: ip})
+	if user != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+auth.CreateToken(&user)))
+	}
+	return ctx
+}
+
+func TestGRPCLimits_UnaryInterceptor(t *testing.T) {
+	table := []struct {
+		method string
+		ctx    context.Context
+		code   codes.Code
+	}{
+		{"/test/Login", grpcCall("10.0.0.1:1000", ""), codes.OK},
+		{"/test/Login", grpcCall("10.0.0.1:2000", ""), codes.ResourceExhausted},
+		{"/test/Login", grpcCall("10.0.0.2:1000", ""), codes.OK},
+		{"/test/Lookup", grpcCall("10.0.0.3:1000", "grpc-limited"), codes.OK},
+		{"/test/Lookup", grpcCall("10.0.0.4:1000", "grpc-limited"), codes.ResourceExhausted},
+		{"/test/Unlimited", grpcCall("10.0.0.1:1000", ""), codes.OK},
+	}
+
+	limits := GRPCLimits{
+		"/test/Login":  {ByIP: New(Config{Rate: 0.001, Burst: 1})},
+		"/test/Lookup": {ByIP: New(Config{Rate: 0.001, Burst: 5}), ByUser: New(Config{Rate: 0.001, Burst: 1})},
+	}
+	interceptor := limits.UnaryInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+
+	for _, entry := range table {
+		// act
+		_, err := interceptor(entry.ctx, nil, &grpc.UnaryServerInfo{FullMethod: entry.method}, handler)
+		// assert
+		if status.Code(err) != entry.code {
+			t.Errorf("Unexpected status for %[1]s. expected: %[2]v, actual: %[3]v", entry.method, entry.code, status.Code(err))
+		}
+	}
+}
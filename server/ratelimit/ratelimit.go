@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"ciphertalk/common/constants"
+	"ciphertalk/server/auth"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// now is replaced in tests to control the clock
+var now = time.Now
+
+// Config describes a token bucket: Rate tokens are added per second up to Burst.
+// Zero Rate disables limiting.
+type Config struct {
+	Rate  float64
+	Burst int
+}
+
+// String implements flag.Value
+func (c *Config) String() string {
+	if c == nil {
+		return ""
+	}
+	return strconv.FormatFloat(c.Rate, 'g', -1, 64) + "," + strconv.Itoa(c.Burst)
+}
+
+// Set implements flag.Value, parses limit in the format of "<rate per second>,<burst>"
+func (c *Config) Set(value string) error {
+	pieces := strings.Split(value, ",")
+	if len(pieces) != 2 {
+		return errors.New("limit must be in the format of <rate>,<burst>")
+	}
+
+	rate, err := strconv.ParseFloat(pieces[0], 64)
+	if err != nil || rate < 0 {
+		return fmt.Errorf("invalid rate %q", pieces[0])
+	}
+
+	burst, err := strconv.Atoi(pieces[1])
+	if err != nil || burst < 1 {
+		return fmt.Errorf("invalid burst %q", pieces[1])
+	}
+
+	c.Rate = rate
+	c.Burst = burst
+	return nil
+}
+
+// Enabled returns true if the config actually limits anything
+func (c Config) Enabled() bool {
+	return c.Rate > 0
+}
+
+// RetryAfter returns number of whole seconds until the next token becomes available
+func (c Config) RetryAfter() int {
+	if !c.Enabled() {
+		return 0
+	}
+	return int(math.Ceil(1 / c.Rate))
+}
+
+// Bucket is a single token bucket
+type Bucket struct {
+	cfg     Config
+	mutex   sync.Mutex
+	tokens  float64
+	updated time.Time
+}
+
+// NewBucket creates a full bucket
+func NewBucket(cfg Config) *Bucket {
+	return &Bucket{cfg: cfg, tokens: float64(cfg.Burst), updated: now()}
+}
+
+// Allow takes a token from the bucket and returns false if there was none left
+func (b *Bucket) Allow() bool {
+	if b == nil || !b.cfg.Enabled() {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+func (b *Bucket) refill() {
+	t := now()
+	b.tokens = math.Min(float64(b.cfg.Burst), b.tokens+t.Sub(b.updated).Seconds()*b.cfg.Rate)
+	b.updated = t
+}
+
+func (b *Bucket) full() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill()
+	return b.tokens >= float64(b.cfg.Burst)
+}
+
+// buckets are pruned once a limiter tracks this many keys
+const pruneThreshold = 10000
+
+// Limiter keeps a token bucket per key (IP address, user name etc.)
+type Limiter struct {
+	cfg     Config
+	mutex   sync.Mutex
+	buckets map[string]*Bucket
+}
+
+// New creates new instance of Limiter
+func New(cfg Config) *Limiter {
+	return &Limiter{cfg: cfg, buckets: make(map[string]*Bucket)}
+}
+
+// Config returns limiter settings
+func (l *Limiter) Config() Config {
+	return l.cfg
+}
+
+// Allow takes a token from the bucket of the given key
+func (l *Limiter) Allow(key string) bool {
+	if l == nil || !l.cfg.Enabled() {
+		return true
+	}
+
+	l.mutex.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= pruneThreshold {
+			l.prune()
+		}
+		b = NewBucket(l.cfg)
+		l.buckets[key] = b
+	}
+	l.mutex.Unlock()
+
+	return b.Allow()
+}
+
+// a bucket that has refilled completely is no different from a new one, so it can be dropped
+func (l *Limiter) prune() {
+	for key, b := range l.buckets {
+		if b.full() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// KeyFunc extracts the key a request is limited by
+type KeyFunc func(r *http.Request) string
+
+// ByIP keys requests by remote address
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByUser keys requests by the user name from the auth token
+func ByUser(r *http.Request) string {
+	user, err := auth.ParseToken(r.Header.Get(constants.HTTPAuthorization))
+	if err != nil {
+		return ""
+	}
+	return user.UserName
+}
+
+// Middleware rejects requests with 429 once the bucket for the request's key is empty.
+// Requests with an empty key are not limited.
+func Middleware(l *Limiter, key KeyFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if k := key(r); k != "" && !l.Allow(k) {
+			w.Header().Set("Retry-After", strconv.Itoa(l.Config().RetryAfter()))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
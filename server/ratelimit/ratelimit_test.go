@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func withClock(t time.Time) func(d time.Duration) {
+	current := t
+	now = func() time.Time { return current }
+	return func(d time.Duration) { current = current.Add(d) }
+}
+
+func TestBucket_Allow(t *testing.T) {
+	// arrange
+	advance := withClock(time.Unix(0, 0))
+	defer func() { now = time.Now }()
+	b := NewBucket(Config{Rate: 1, Burst: 2})
+	// act & assert
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("Burst should be allowed")
+	}
+
+	if b.Allow() {
+		t.Error("Request over burst should be rejected")
+	}
+
+	advance(time.Second)
+
+	if !b.Allow() {
+		t.Error("Bucket should refill over time")
+	}
+}
+
+func TestBucket_Disabled(t *testing.T) {
+	b := NewBucket(Config{})
+
+	for i := 0; i < 100; i++ {
+		if !b.Allow() {
+			t.Fatal("Zero config should not limit anything")
+		}
+	}
+}
+
+func TestLimiter_KeysAreIndependent(t *testing.T) {
+	// arrange
+	withClock(time.Unix(0, 0))
+	defer func() { now = time.Now }()
+	l := New(Config{Rate: 1, Burst: 1})
+	// act
+	l.Allow("foo")
+	// assert
+	if l.Allow("foo") {
+		t.Error("Second request for the same key should be rejected")
+	}
+
+	if !l.Allow("bar") {
+		t.Error("Different key should have its own bucket")
+	}
+}
+
+var invalidConfigTable = []string{"", "1", "a,1", "1,a", "1,0", "-1,1"}
+
+func TestConfig_Set(t *testing.T) {
+	var c Config
+	if err := c.Set("0.5,10"); err != nil || c.Rate != 0.5 || c.Burst != 10 {
+		t.Errorf("Unexpected config: %v, error: %v", c, err)
+	}
+
+	for _, entry := range invalidConfigTable {
+		if err := c.Set(entry); err == nil {
+			t.Errorf("Expected to get an error for %q", entry)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	// arrange
+	withClock(time.Unix(0, 0))
+	defer func() { now = time.Now }()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(New(Config{Rate: 0.5, Burst: 1}), ByIP, next)
+	codes := []int{}
+	// act
+	for i := 0; i < 2; i++ {
+		wr := httptest.NewRecorder()
+		handler.ServeHTTP(wr, httptest.NewRequest("POST", "/login", nil))
+		codes = append(codes, wr.Code)
+
+		if wr.Code == http.StatusTooManyRequests && wr.Header().Get("Retry-After") != "2" {
+			t.Errorf("Unexpected Retry-After header: %v", wr.Header().Get("Retry-After"))
+		}
+	}
+	// assert
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("Unexpected status codes: %v", codes)
+	}
+}
@@ -2,32 +2,178 @@ package server
 
 import (
 	"ciphertalk/common/constants"
+	"ciphertalk/common/pb"
+	"ciphertalk/server/apidoc"
 	"ciphertalk/server/auth"
 	"ciphertalk/server/controller"
-	"log"
+	"ciphertalk/server/logging"
+	"ciphertalk/server/metrics"
+	"ciphertalk/server/origin"
+	"ciphertalk/server/ratelimit"
+	"ciphertalk/server/web"
+	"crypto/tls"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// Config holds server settings
+type Config struct {
+	Port       string
+	Logging    logging.Config
+	RateLimits RateLimits
+	Validation controller.Validation
+	// MaxBlobSize and BlobCapacity limit encrypted file chunks kept in memory
+	MaxBlobSize  int64
+	BlobCapacity int64
+	// BlobQuota and BlobRetention limit file chunks kept for one user and how long they are kept
+	BlobQuota     int64
+	BlobRetention time.Duration
+	// QueueSize and QueueRetention limit messages kept for offline recipients
+	QueueSize      int
+	QueueRetention time.Duration
+	// AllowedOrigins lists browser origins which may call the API and open websockets from other sites
+	AllowedOrigins origin.AllowList
+	// KeyRotation is how often the token signing key is replaced
+	KeyRotation time.Duration
+	// TLS enables HTTPS and wss when configured
+	TLS TLSConfig
+	// AdminToken authorizes requests to the admin API, the API is disabled when it is empty
+	AdminToken string
+	// GRPCPort serves the gRPC API on a separate port, the API is disabled when it is empty
+	GRPCPort string
+}
+
+// RateLimits holds token bucket settings for every route
+type RateLimits struct {
+	// Login is applied per IP address and per requested user name
+	Login ratelimit.Config
+	// Secure is applied per IP address and per authenticated user
+	Secure ratelimit.Config
+	// Websocket limits connection attempts per IP address
+	Websocket ratelimit.Config
+	// Messages is applied per websocket connection
+	Messages ratelimit.Config
+	// Signals is applied per websocket connection to typing indicators and other ephemeral signals
+	Signals ratelimit.Config
+	// Blobs is applied per IP address and per authenticated user to file chunk uploads and downloads
+	Blobs ratelimit.Config
+}
+
 // Initialize - registers routes and starts up the server
-func Initialize() {
+func Initialize(cfg Config) {
+	logger := logging.New(os.Stdout, cfg.Logging)
+	auth.SetLogger(logger)
+	auth.StartKeyRotation(cfg.KeyRotation)
+
+	handler, controller, grpcLimits := newHandler(logger, cfg)
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: handler}
+
+	var err error
+	if cfg.TLS.Enabled() {
+		srv.TLSConfig, err = buildTLSConfig(cfg.TLS)
+		if err != nil {
+			logger.Error("invalid TLS configuration", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.GRPCPort != "" {
+		go serveGRPC(logger, controller, grpcLimits, cfg.GRPCPort, srv.TLSConfig)
+	}
+
+	if cfg.TLS.Enabled() {
+
+		if leaf := srv.TLSConfig.Certificates[0].Leaf; leaf != nil {
+			logger.Info("serving TLS certificate", "pin_sha256", publicKeyPin(leaf), "expires", leaf.NotAfter)
+		}
+
+		logger.Info("server started", "port", cfg.Port, "tls", true, "mtls", srv.TLSConfig.ClientCAs != nil)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		logger.Info("server started", "port", cfg.Port)
+		err = srv.ListenAndServe()
+	}
+
+	if err != nil {
+		logger.Error("ListenAndServe failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// NewHandler creates the controller and the handler which serves every route of the HTTP API
+func NewHandler(logger *slog.Logger, cfg Config) (http.Handler, *controller.APIController) {
+	handler, controller, _ := newHandler(logger, cfg)
+	return handler, controller
+}
+
+// newHandler also returns the rate limits which gRPC methods share with their HTTP routes
+func newHandler(logger *slog.Logger, cfg Config) (http.Handler, *controller.APIController, ratelimit.GRPCLimits) {
 	router := mux.NewRouter()
-	controller := controller.NewAPIController()
-	registerRoutes(router, controller)
+	router.Use(recordRoute)
+	controller := controller.NewAPIController(logger, controller.Config{
+		LoginLimit:     cfg.RateLimits.Login,
+		MessageLimit:   cfg.RateLimits.Messages,
+		SignalLimit:    cfg.RateLimits.Signals,
+		Validation:     cfg.Validation,
+		MaxBlobSize:    cfg.MaxBlobSize,
+		BlobCapacity:   cfg.BlobCapacity,
+		BlobQuota:      cfg.BlobQuota,
+		BlobRetention:  cfg.BlobRetention,
+		QueueSize:      cfg.QueueSize,
+		QueueRetention: cfg.QueueRetention,
+		AllowedOrigins: cfg.AllowedOrigins,
+	})
+	grpcLimits := registerRoutes(router, controller, cfg.RateLimits, cfg.AllowedOrigins)
+	if cfg.AdminToken != "" {
+		registerAdminRoutes(router, controller, cfg.AdminToken)
+	}
+
+	return logging.Middleware(logger, router), controller, grpcLimits
+}
 
-	var port = "3000"
-	log.Println("Server started on port " + port)
-	err := http.ListenAndServe(":"+port, handlers.LoggingHandler(os.Stdout, router))
+// recordRoute lets request logs show the matched route template instead of a path which may contain a user name
+func recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if template, err := mux.CurrentRoute(r).GetPathTemplate(); err == nil {
+			logging.SetRoute(r, template)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
+// serveGRPC serves the gRPC API, it shares TLS settings and rate limits with the HTTP server
+func serveGRPC(logger *slog.Logger, controller *controller.APIController, limits ratelimit.GRPCLimits, port string, tlsConfig *tls.Config) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(limits.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(limits.StreamInterceptor()),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	listener, err := net.Listen("tcp", ":"+port)
 	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+		logger.Error("unable to listen for gRPC", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("gRPC server started", "port", port, "tls", tlsConfig != nil)
+	if err = controller.NewGRPCServer(opts...).Serve(listener); err != nil {
+		logger.Error("gRPC server failed", "error", err)
+		os.Exit(1)
 	}
 }
 
-func registerRoutes(router *mux.Router, controller *controller.APIController) {
+// registerRoutes registers the HTTP API and returns the limits of gRPC methods, which share the buckets of the
+// matching routes so clients can not double their budget by switching protocols
+func registerRoutes(router *mux.Router, controller *controller.APIController, limits RateLimits, allowed origin.AllowList) ratelimit.GRPCLimits {
 	var handleWebsockets = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		controller.HandleWebsockets(w, r)
 	})
@@ -36,12 +182,111 @@ func registerRoutes(router *mux.Router, controller *controller.APIController) {
 		controller.SecureChannel(w, r)
 	})
 
+	var websocketsByIP = ratelimit.New(limits.Websocket)
+	var loginByIP = ratelimit.New(limits.Login)
+	var registerByIP = ratelimit.New(limits.Login)
+	var secureByIP = ratelimit.New(limits.Secure)
+	var secureByUser = ratelimit.New(limits.Secure)
+	var sealedByIP = ratelimit.New(limits.Messages)
+	var messagesByIP = ratelimit.New(limits.Messages)
+	var blobsByIP = ratelimit.New(limits.Blobs)
+	var blobsByUser = ratelimit.New(limits.Blobs)
+	var cors = allowed.CORS()
+
 	// route for sending and recieving messages
-	router.Handle("/websockets", auth.JwtMiddleware.Handler(handleWebsockets)).Methods(constants.HTTPGet)
+	router.Handle("/websockets",
+		ratelimit.Middleware(websocketsByIP, ratelimit.ByIP,
+			auth.WebsocketToken(
+				auth.RequireScope(auth.ScopeChatSend, handleWebsockets)))).Methods(constants.HTTPGet)
+
+	// HTTP fallback for networks which block websockets, it shares routing with /websockets.
+	// Messages are also limited per IP address, so unknown recipients can not be probed with many accounts.
+	router.Handle("/messages", cors(metrics.Instrument("messages",
+		ratelimit.Middleware(messagesByIP, ratelimit.ByIP,
+			auth.RequireScope(auth.ScopeChatSend, http.HandlerFunc(controller.SendMessage)))))).Methods(constants.HTTPPost, constants.HTTPOptions)
+	router.Handle("/messages/stream", cors(
+		ratelimit.Middleware(websocketsByIP, ratelimit.ByIP,
+			auth.WebsocketToken(
+				auth.RequireScope(auth.ScopeChatSend, http.HandlerFunc(controller.StreamMessages)))))).Methods(constants.HTTPGet, constants.HTTPOptions)
 
 	// authentication route
-	router.HandleFunc("/login", controller.Login).Methods(constants.HTTPPost)
+	router.Handle("/login", cors(metrics.Instrument("login",
+		ratelimit.Middleware(loginByIP, ratelimit.ByIP,
+			http.HandlerFunc(controller.Login))))).Methods(constants.HTTPPost, constants.HTTPOptions)
+
+	// account registration route
+	router.Handle("/register", cors(metrics.Instrument("register",
+		ratelimit.Middleware(registerByIP, ratelimit.ByIP,
+			http.HandlerFunc(controller.Register))))).Methods(constants.HTTPPost, constants.HTTPOptions)
 
 	// route for creating channels between users
-	router.Handle("/secure", auth.JwtMiddleware.Handler(handleSecureChannels)).Methods(constants.HTTPPost)
+	router.Handle("/secure", cors(metrics.Instrument("secure",
+		ratelimit.Middleware(secureByIP, ratelimit.ByIP,
+			auth.RequireScope(auth.ScopeDirectoryRead,
+				ratelimit.Middleware(secureByUser, ratelimit.ByUser, handleSecureChannels)))))).Methods(constants.HTTPPost, constants.HTTPOptions)
+
+	// route for issuing single-use tickets which open websockets from browsers
+	router.Handle("/ws-ticket", cors(
+		ratelimit.Middleware(websocketsByIP, ratelimit.ByIP,
+			auth.RequireScope(auth.ScopeChatSend, http.HandlerFunc(controller.WebsocketTicket))))).Methods(constants.HTTPPost, constants.HTTPOptions)
+
+	// route for issuing certificates which authorize sealed sender delivery
+	router.Handle("/delivery-certificate", auth.RequireScope(auth.ScopeChatSend, http.HandlerFunc(controller.DeliveryCertificate))).Methods(constants.HTTPPost)
+
+	// route for sending sealed sender messages, intentionally not authenticated so the sender stays anonymous
+	router.Handle("/sealed",
+		ratelimit.Middleware(sealedByIP, ratelimit.ByIP,
+			http.HandlerFunc(controller.SendSealed))).Methods(constants.HTTPPost)
+
+	// routes for uploading, downloading and deleting encrypted file chunks
+	var limitBlobs = func(handler http.HandlerFunc) http.Handler {
+		return ratelimit.Middleware(blobsByIP, ratelimit.ByIP,
+			auth.RequireScope(auth.ScopeChatSend,
+				ratelimit.Middleware(blobsByUser, ratelimit.ByUser, handler)))
+	}
+	router.Handle("/blobs/{hash}", limitBlobs(controller.UploadBlob)).Methods(constants.HTTPPut)
+	router.Handle("/blobs/{hash}", limitBlobs(controller.DownloadBlob)).Methods(constants.HTTPGet)
+	router.Handle("/blobs/{hash}", limitBlobs(controller.DeleteBlob)).Methods(constants.HTTPDelete)
+
+	// browser client
+	router.Handle("/app", http.RedirectHandler("/app/", http.StatusMovedPermanently)).Methods(constants.HTTPGet)
+	router.PathPrefix("/app/").Handler(web.Handler()).Methods(constants.HTTPGet)
+
+	// API descriptions and docs generated from them
+	router.Handle("/openapi.json", cors(apidoc.Handler(apidoc.OpenAPI))).Methods(constants.HTTPGet, constants.HTTPOptions)
+	router.Handle("/asyncapi.json", cors(apidoc.Handler(apidoc.AsyncAPI))).Methods(constants.HTTPGet, constants.HTTPOptions)
+	router.Handle("/docs", apidoc.DocsHandler()).Methods(constants.HTTPGet)
+
+	// route for publishing public keys which verify auth tokens
+	router.Handle("/.well-known/jwks.json", auth.JWKSHandler()).Methods(constants.HTTPGet)
+
+	// route for scraping server metrics
+	router.Handle("/metrics", metrics.Handler()).Methods(constants.HTTPGet)
+
+	return ratelimit.GRPCLimits{
+		pb.Ciphertalk_Register_FullMethodName:     {ByIP: registerByIP},
+		pb.Ciphertalk_Login_FullMethodName:        {ByIP: loginByIP},
+		pb.Ciphertalk_GetPublicKey_FullMethodName: {ByIP: secureByIP, ByUser: secureByUser},
+		pb.Ciphertalk_Chat_FullMethodName:         {ByIP: websocketsByIP},
+	}
+}
+
+func registerAdminRoutes(router *mux.Router, controller *controller.APIController, adminToken string) {
+	admin := router.PathPrefix("/admin").Subrouter()
+	handle := func(path string, handler http.HandlerFunc, method string) {
+		admin.Handle(path, auth.AdminMiddleware(adminToken, handler)).Methods(method)
+	}
+
+	// routes for inspecting users and sessions
+	handle("/users", controller.ListUsers, constants.HTTPGet)
+	handle("/sessions", controller.ListSessions, constants.HTTPGet)
+
+	// route for issuing tokens with specific scopes
+	handle("/tokens", controller.IssueToken, constants.HTTPPost)
+
+	// routes for forcing logout, revoking keys and banning users
+	handle("/users/{name}/logout", controller.Logout, constants.HTTPPost)
+	handle("/users/{name}/key", controller.RevokeKey, constants.HTTPDelete)
+	handle("/users/{name}/ban", controller.Ban, constants.HTTPPut)
+	handle("/users/{name}/ban", controller.Unban, constants.HTTPDelete)
 }
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewHandler_LogsRouteTemplate(t *testing.T) {
+	// arrange
+	var out bytes.Buffer
+	handler, ctrl := NewHandler(slog.New(slog.NewTextHandler(&out, nil)), Config{AdminToken: testAdminToken})
+	defer ctrl.Close()
+	req := httptest.NewRequest("PUT", "/admin/users/route-bob/ban", nil)
+	// act
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	// assert
+	if strings.Contains(out.String(), "route-bob") {
+		t.Errorf("User name in the path was written to the log: %s", out.String())
+	}
+
+	if !strings.Contains(out.String(), "path=/admin/users/{name}/ban") {
+		t.Errorf("Route template was not logged: %s", out.String())
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// TLSConfig holds settings for serving HTTPS and wss
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM encoded certificate chain and private key
+	CertFile string
+	KeyFile  string
+	// SelfSigned generates a throwaway certificate for localhost, for development only
+	SelfSigned bool
+	// ClientCAFile is a PEM bundle of CAs, when set clients must present a certificate signed by one of them
+	ClientCAFile string
+}
+
+// Enabled returns true if the server should serve TLS. A client CA alone enables it too, so the configuration
+// is rejected by buildTLSConfig instead of silently serving plain HTTP without mTLS.
+func (cfg TLSConfig) Enabled() bool {
+	return cfg.SelfSigned || cfg.CertFile != "" || cfg.KeyFile != "" || cfg.ClientCAFile != ""
+}
+
+func buildTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	switch {
+	case cfg.SelfSigned && (cfg.CertFile != "" || cfg.KeyFile != ""):
+		return nil, errors.New("self-signed mode can not be combined with certificate files")
+	case !cfg.SelfSigned && cfg.CertFile == "" && cfg.KeyFile == "":
+		return nil, errors.New("client CA file requires TLS, set certificate and key files or self-signed mode")
+	case cfg.SelfSigned:
+		cert, err = selfSignedCertificate([]string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback})
+	case cfg.CertFile == "" || cfg.KeyFile == "":
+		return nil, errors.New("both certificate and key files are required")
+	default:
+		cert, err = tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + cfg.ClientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+func selfSignedCertificate(hosts []string, ips []net.IP) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "ciphertalk development"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     hosts,
+		IPAddresses:  ips,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// publicKeyPin returns base64 sha256 of the certificate's public key, the value clients pass to --pin-sha256
+func publicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
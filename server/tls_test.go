@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestBuildTLSConfig_SelfSigned(t *testing.T) {
+	// arrange
+	cfg := TLSConfig{SelfSigned: true}
+	// act
+	config, err := buildTLSConfig(cfg)
+	// assert
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	leaf := config.Certificates[0].Leaf
+	if err = leaf.VerifyHostname("localhost"); err != nil {
+		t.Error("Certificate is not valid for localhost:", err)
+	}
+
+	if len(publicKeyPin(leaf)) != 44 {
+		t.Errorf("Unexpected pin: %v", publicKeyPin(leaf))
+	}
+}
+
+var invalidTLSTable = []TLSConfig{
+	{SelfSigned: true, CertFile: "cert.pem"},
+	{CertFile: "cert.pem"},
+	{KeyFile: "key.pem"},
+	{CertFile: "missing.pem", KeyFile: "missing.key"},
+	{SelfSigned: true, ClientCAFile: "missing.pem"},
+	{ClientCAFile: "ca.pem"},
+}
+
+func TestBuildTLSConfig_Invalid(t *testing.T) {
+	for _, entry := range invalidTLSTable {
+		// invalid configurations must not be ignored as plain HTTP
+		if !entry.Enabled() {
+			t.Errorf("Configuration is ignored: %+v", entry)
+		}
+
+		if _, err := buildTLSConfig(entry); err == nil {
+			t.Errorf("Expected an error for %+v", entry)
+		}
+	}
+}
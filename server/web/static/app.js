@@ -0,0 +1,349 @@
+// Browser client for ciphertalk. Messages are encrypted with nacl.box exactly like the Go client does,
+// so both clients can talk to each other. Keys are generated on every login and never leave the page.
+(function () {
+  "use strict";
+
+  var CONTENT_VERSION = 1;
+
+  var state = {
+    user: "",
+    peer: "",
+    token: "",
+    keys: null,
+    peerKey: null,
+    // public keys of other senders, looked up on demand
+    senderKeys: {},
+    socket: null
+  };
+
+  var loginForm = document.getElementById("login");
+  var composeForm = document.getElementById("compose");
+  var messages = document.getElementById("messages");
+  var statusLine = document.getElementById("status");
+
+  function setStatus(text) {
+    statusLine.textContent = text || "";
+  }
+
+  function bytesToBase64(bytes) {
+    var binary = "";
+    for (var i = 0; i < bytes.length; i++) {
+      binary += String.fromCharCode(bytes[i]);
+    }
+    return btoa(binary);
+  }
+
+  function base64ToBytes(text) {
+    var binary = atob(text);
+    var bytes = new Uint8Array(binary.length);
+    for (var i = 0; i < binary.length; i++) {
+      bytes[i] = binary.charCodeAt(i);
+    }
+    return bytes;
+  }
+
+  // keys and nonces are unpadded base64url strings in JSON, see models.Key32
+  function bytesToBase64url(bytes) {
+    return bytesToBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+
+  function base64urlToBytes(text) {
+    var padded = text.replace(/-/g, "+").replace(/_/g, "/");
+    while (padded.length % 4 !== 0) {
+      padded += "=";
+    }
+    return base64ToBytes(padded);
+  }
+
+  function randomID() {
+    return Array.from(nacl.randomBytes(16), function (b) {
+      return ("0" + b.toString(16)).slice(-2);
+    }).join("");
+  }
+
+  function request(method, path, body, token) {
+    var headers = { "Content-Type": "application/json" };
+    if (token) {
+      headers.Authorization = "Bearer " + token;
+    }
+
+    return fetch(path, { method: method, headers: headers, body: body ? JSON.stringify(body) : undefined })
+      .then(function (response) {
+        if (response.ok) {
+          return response.status === 200 ? response.json() : null;
+        }
+        return response.text().then(function (text) {
+          var err = new Error(text.trim() || response.statusText);
+          err.status = response.status;
+          throw err;
+        });
+      });
+  }
+
+  function register(user, password) {
+    return request("POST", "/register", { userName: user, password: password }).catch(function (err) {
+      // the account already exists, logging in will verify the password
+      if (err.status !== 409) {
+        throw err;
+      }
+    });
+  }
+
+  function login(user, password) {
+    state.keys = nacl.box.keyPair();
+    return request("POST", "/login", {
+      userName: user,
+      password: password,
+      publicKey: bytesToBase64url(state.keys.publicKey)
+    }).then(function (response) {
+      state.token = response.authToken;
+    });
+  }
+
+  function lookupKey(user) {
+    return request("POST", "/secure", { userName: user }, state.token).then(function (response) {
+      return base64urlToBytes(response.publicKey);
+    });
+  }
+
+  function waitForPeer() {
+    return lookupKey(state.peer).catch(function (err) {
+      if (err.status !== 404) {
+        throw err;
+      }
+      setStatus(state.peer + " has not registered yet, waiting...");
+      return new Promise(function (resolve) { setTimeout(resolve, 3000); }).then(waitForPeer);
+    });
+  }
+
+  function connect() {
+    return request("POST", "/ws-ticket", null, state.token).then(function (response) {
+      var scheme = location.protocol === "https:" ? "wss:" : "ws:";
+      var socket = new WebSocket(scheme + "//" + location.host + "/websockets?ticket=" + encodeURIComponent(response.ticket));
+
+      socket.onmessage = function (event) {
+        receive(JSON.parse(event.data)).catch(function (err) {
+          notice("unable to read message: " + err.message);
+        });
+      };
+      socket.onclose = function () {
+        setStatus("disconnected, log in again to reconnect");
+        composeForm.querySelector("button").disabled = true;
+      };
+
+      state.socket = socket;
+      return new Promise(function (resolve, reject) {
+        socket.onopen = resolve;
+        socket.onerror = function () { reject(new Error("unable to connect")); };
+      });
+    });
+  }
+
+  function encryptPayload(payload) {
+    var nonce = nacl.randomBytes(nacl.box.nonceLength);
+    var body = nacl.box(new TextEncoder().encode(JSON.stringify(payload)), nonce, state.peerKey, state.keys.secretKey);
+
+    return {
+      id: payload.id,
+      senderId: state.user,
+      recepientId: state.peer,
+      body: bytesToBase64(body),
+      timeStamp: new Date().toISOString(),
+      msgNonce: bytesToBase64url(nonce)
+    };
+  }
+
+  function sendText(text) {
+    var payload = { v: CONTENT_VERSION, type: "text", id: randomID(), text: text };
+    state.socket.send(JSON.stringify(encryptPayload(payload)));
+    show(payload.id, state.user, text, true);
+  }
+
+  function senderKey(sender) {
+    if (sender === state.peer) {
+      return Promise.resolve(state.peerKey);
+    }
+    if (!state.senderKeys[sender]) {
+      state.senderKeys[sender] = lookupKey(sender);
+    }
+    return state.senderKeys[sender];
+  }
+
+  // decodePayload mirrors models.DecodePayload: bodies which are not JSON come from old clients and are plain text
+  function decodePayload(bytes) {
+    var text = new TextDecoder().decode(bytes);
+    var payload = null;
+    if (text.trim().charAt(0) === "{") {
+      try {
+        payload = JSON.parse(text);
+      } catch (e) {
+        payload = null;
+      }
+    }
+
+    if (!payload || (!payload.v && !payload.text && !payload.file && !payload.signal && !payload.delete)) {
+      return { type: "text", text: text };
+    }
+
+    payload.type = payload.type || inferType(payload);
+    return payload;
+  }
+
+  function inferType(payload) {
+    if (payload.signal) {
+      return "signal";
+    } else if (payload.delete) {
+      return "delete";
+    } else if (payload.edit) {
+      return "edit";
+    } else if (payload.reaction) {
+      return "reaction";
+    } else if (payload.file) {
+      return "file";
+    } else if (payload.replyTo) {
+      return "reply";
+    }
+    return "text";
+  }
+
+  function receive(msg) {
+    if (msg.error !== undefined && msg.code !== undefined) {
+      notice("server rejected message: " + msg.error + " (" + msg.code + ")");
+      return Promise.resolve();
+    }
+
+    if (msg.sealed) {
+      notice("received a sealed sender message, use the Go client to read it");
+      return Promise.resolve();
+    }
+
+    return senderKey(msg.senderId).then(function (key) {
+      var plain = nacl.box.open(base64ToBytes(msg.body), base64urlToBytes(msg.msgNonce), key, state.keys.secretKey);
+      if (!plain) {
+        notice("unable to decrypt message from " + msg.senderId);
+        return;
+      }
+
+      render(msg, decodePayload(plain));
+    });
+  }
+
+  function render(msg, payload) {
+    if (msg.ephemeral) {
+      if (payload.signal === "typing") {
+        setStatus(msg.senderId + " is typing...");
+      } else {
+        setStatus("");
+      }
+      return;
+    }
+
+    if (payload.expiresAt && payload.expiresAt * 1000 <= Date.now()) {
+      return;
+    }
+
+    var id = payload.id || msg.id;
+    switch (payload.type) {
+      case "delete":
+        remove(payload.delete, msg.senderId);
+        break;
+      case "edit":
+        edit(payload.edit, msg.senderId, payload.text);
+        break;
+      case "reaction":
+        notice(msg.senderId + " " + payload.text);
+        break;
+      case "reply":
+        show(id, msg.senderId, "↪ " + payload.text, false, payload.expiresAt);
+        break;
+      case "file":
+        notice(msg.senderId + " sent file " + payload.file.name + ", use the Go client to download it");
+        break;
+      case "text":
+        show(id, msg.senderId, payload.text, false, payload.expiresAt);
+        break;
+      default:
+        show(id, msg.senderId, payload.text || "(" + payload.type + " message, not supported here)", false, payload.expiresAt);
+    }
+    setStatus("");
+  }
+
+  function show(id, sender, text, own, expiresAt) {
+    var item = document.createElement("li");
+    item.dataset.id = id || "";
+    item.dataset.sender = sender;
+    item.className = own ? "own" : "";
+    item.textContent = sender + ": " + text;
+    messages.appendChild(item);
+
+    if (expiresAt) {
+      setTimeout(function () { item.remove(); }, expiresAt * 1000 - Date.now());
+    }
+  }
+
+  function notice(text) {
+    var item = document.createElement("li");
+    item.className = "notice";
+    item.textContent = text;
+    messages.appendChild(item);
+  }
+
+  function find(id, sender) {
+    return Array.from(messages.children).find(function (item) {
+      return item.dataset.id === id && item.dataset.sender === sender;
+    });
+  }
+
+  function remove(id, sender) {
+    var item = find(id, sender);
+    if (item) {
+      item.remove();
+    }
+  }
+
+  function edit(id, sender, text) {
+    var item = find(id, sender);
+    if (item) {
+      item.textContent = sender + ": " + text + " (edited)";
+    }
+  }
+
+  loginForm.addEventListener("submit", function (event) {
+    event.preventDefault();
+    var form = new FormData(loginForm);
+    var action = event.submitter ? event.submitter.value : "login";
+
+    state.user = form.get("user");
+    state.peer = form.get("peer");
+    setStatus("logging in...");
+
+    var start = action === "register" ? register(state.user, form.get("password")) : Promise.resolve();
+    start
+      .then(function () { return login(state.user, form.get("password")); })
+      .then(waitForPeer)
+      .then(function (key) {
+        state.peerKey = key;
+        return connect();
+      })
+      .then(function () {
+        loginForm.hidden = true;
+        document.getElementById("chat").hidden = false;
+        document.getElementById("title").textContent = state.user + " → " + state.peer;
+        composeForm.querySelector("button").disabled = false;
+        setStatus("");
+      })
+      .catch(function (err) {
+        setStatus(err.message);
+      });
+  });
+
+  composeForm.addEventListener("submit", function (event) {
+    event.preventDefault();
+    var input = composeForm.elements.text;
+    if (input.value.trim() === "") {
+      return;
+    }
+    sendText(input.value.trim());
+    input.value = "";
+  });
+})();
@@ -0,0 +1,31 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// static holds the browser client. Messages are encrypted in the browser with tweetnacl's box, which is compatible
+// with nacl/box used by the Go client, so the server never sees plaintext from either client.
+//
+//go:embed static
+var static embed.FS
+
+// Handler serves the browser client, it is mounted under /app/
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	fileServer := http.StripPrefix("/app/", http.FileServer(http.FS(files)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// scripts come only from the server itself, so injected markup can not exfiltrate keys
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; connect-src 'self' ws: wss:; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		fileServer.ServeHTTP(w, r)
+	})
+}
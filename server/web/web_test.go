@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var assetTable = []struct {
+	path     string
+	expected int
+	contains string
+}{
+	{"/app/", http.StatusOK, "app.js"},
+	{"/app/app.js", http.StatusOK, "nacl.box"},
+	{"/app/vendor/nacl-fast.min.js", http.StatusOK, "nacl"},
+	{"/app/missing.js", http.StatusNotFound, ""},
+}
+
+func TestHandler(t *testing.T) {
+	for _, entry := range assetTable {
+		// arrange
+		wr := httptest.NewRecorder()
+		// act
+		Handler().ServeHTTP(wr, httptest.NewRequest("GET", entry.path, nil))
+		// assert
+		if wr.Code != entry.expected {
+			t.Errorf("Unexpected status code for %v. expected: %v, actual %v", entry.path, entry.expected, wr.Code)
+		}
+
+		if !strings.Contains(wr.Body.String(), entry.contains) {
+			t.Errorf("Unexpected content for %v", entry.path)
+		}
+
+		if !strings.Contains(wr.Header().Get("Content-Security-Policy"), "default-src 'self'") {
+			t.Errorf("Content-Security-Policy is not set for %v", entry.path)
+		}
+	}
+}